@@ -0,0 +1,148 @@
+package ziptools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Point represents a geographic point.
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// Ring represents a closed line of points, the last point equals to the first one.
+type Ring []Point
+
+// Polygon represents an area bounded by the outer ring, the following rings are holes.
+type Polygon []Ring
+
+// Boundary represents the area of a zip code (ZCTA) as a set of polygons.
+type Boundary []Polygon
+
+// Contains reports whether the point lies within the ring using the even-odd rule.
+func (r Ring) Contains(lat, lon float64) bool {
+	in := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a.Lat > lat) != (b.Lat > lat) &&
+			lon < (b.Lon-a.Lon)*(lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			in = !in
+		}
+	}
+	return in
+}
+
+// Contains reports whether the point lies within the polygon and not within its holes.
+func (p Polygon) Contains(lat, lon float64) bool {
+	if len(p) == 0 || !p[0].Contains(lat, lon) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.Contains(lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains reports whether the point lies within any polygon of the boundary.
+func (b Boundary) Contains(lat, lon float64) bool {
+	for _, p := range b {
+		if p.Contains(lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bounds returns the bounding box of the boundary.
+func (b Boundary) Bounds() (min, max Point) {
+	min = Point{Lat: math.Inf(1), Lon: math.Inf(1)}
+	max = Point{Lat: math.Inf(-1), Lon: math.Inf(-1)}
+	for _, p := range b {
+		for _, r := range p {
+			for _, pt := range r {
+				min.Lat, max.Lat = math.Min(min.Lat, pt.Lat), math.Max(max.Lat, pt.Lat)
+				min.Lon, max.Lon = math.Min(min.Lon, pt.Lon), math.Max(max.Lon, pt.Lon)
+			}
+		}
+	}
+	return
+}
+
+// boundaryVersion is the version of the binary encoding of boundaries.
+const boundaryVersion = 1
+
+// Bytes returns a serialized version of a boundary. Counts are uvarints,
+// coordinates are little endian float32 pairs.
+//
+//  [version][polygons]([rings]([points]([lat][lon]...)...)...)
+func (b Boundary) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(boundaryVersion)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	putCount := func(n int) {
+		buf.Write(tmp[:binary.PutUvarint(tmp, uint64(n))])
+	}
+	putCount(len(b))
+	for _, p := range b {
+		putCount(len(p))
+		for _, r := range p {
+			putCount(len(r))
+			for _, pt := range r {
+				binary.Write(&buf, binary.LittleEndian, [2]float32{float32(pt.Lat), float32(pt.Lon)})
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// FromBytes constructs a new boundary from bytes. Malformed data yields an empty boundary.
+func (b *Boundary) FromBytes(data []byte) Boundary {
+	b.Decode(data)
+	return *b
+}
+
+// Decode decodes a boundary from bytes, the boundary is nil on errors and for empty bytes.
+func (b *Boundary) Decode(data []byte) error {
+	*b = nil
+	if len(data) == 0 {
+		return nil
+	}
+	r := recordReader{b: data}
+	r.version(boundaryVersion, "boundary")
+	return b.decode(&r)
+}
+
+// decodeLegacy decodes a boundary of databases built before boundaries were versioned.
+func (b *Boundary) decodeLegacy(data []byte) error {
+	*b = nil
+	if len(data) == 0 {
+		return nil
+	}
+	return b.decode(&recordReader{b: data})
+}
+
+func (b *Boundary) decode(r *recordReader) error {
+	// every counted item takes at least a byte, points take 8
+	boundary := make(Boundary, r.count(1))
+	for i := range boundary {
+		polygon := make(Polygon, r.count(1))
+		for j := range polygon {
+			ring := make(Ring, r.count(8))
+			for k := range ring {
+				ring[k].Lat = float64(r.float32())
+				ring[k].Lon = float64(r.float32())
+			}
+			polygon[j] = ring
+		}
+		boundary[i] = polygon
+	}
+	if err := r.end(); err != nil {
+		return err
+	}
+	*b = boundary
+	return nil
+}
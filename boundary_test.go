@@ -0,0 +1,72 @@
+package ziptools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testBoundary = Boundary{
+	{
+		{{0, 0}, {0, 4}, {4, 4}, {4, 0}, {0, 0}},
+		{{1, 1}, {1, 2}, {2, 2}, {2, 1}, {1, 1}},
+	},
+	{
+		{{10, 10}, {10, 11}, {11, 11}, {10, 10}},
+	},
+}
+
+func TestBoundaryContains(t *testing.T) {
+	assert.True(t, testBoundary.Contains(3, 3))
+	assert.True(t, testBoundary.Contains(10.2, 10.5))
+	assert.False(t, testBoundary.Contains(1.5, 1.5), "point in a hole")
+	assert.False(t, testBoundary.Contains(5, 5))
+	assert.False(t, Boundary{}.Contains(0, 0))
+}
+
+func TestBoundaryBounds(t *testing.T) {
+	min, max := testBoundary.Bounds()
+	assert.Equal(t, Point{0, 0}, min)
+	assert.Equal(t, Point{11, 11}, max)
+}
+
+func TestBoundaryBytes(t *testing.T) {
+	var b Boundary
+	assert.Equal(t, testBoundary, b.FromBytes(testBoundary.Bytes()))
+	assert.Equal(t, []byte{boundaryVersion, 0}, Boundary{}.Bytes())
+}
+
+func TestBoundaryFromBytes(t *testing.T) {
+	var b Boundary
+	data := testBoundary.Bytes()
+	assert.Empty(t, b.FromBytes(data[:len(data)-1]))
+	assert.Empty(t, b.FromBytes([]byte{0xff, 0xff, 0xff}))
+	assert.Empty(t, b.FromBytes(nil))
+}
+
+func TestBoundaryDecode(t *testing.T) {
+	var b Boundary
+	data := testBoundary.Bytes()
+	assert.NoError(t, b.Decode(data))
+	assert.Equal(t, testBoundary, b)
+	assert.Equal(t, ErrMalformedRecord, b.Decode(data[:len(data)-1]))
+	assert.Equal(t, ErrMalformedRecord, b.Decode(append(data, 0)))
+	assert.Equal(t, ErrMalformedRecord, b.Decode([]byte{boundaryVersion, 1, 1, 0xff, 0xff, 0xff, 0xff, 0x0f}))
+	assert.Error(t, b.Decode(append([]byte{boundaryVersion + 1}, data[1:]...)), "unknown version")
+	assert.Nil(t, b)
+}
+
+func FuzzBoundary(f *testing.F) {
+	f.Add(testBoundary.Bytes())
+	f.Add([]byte{boundaryVersion, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var b Boundary
+		if b.Decode(data) != nil {
+			assert.Nil(t, b)
+			return
+		}
+		var got Boundary
+		assert.NoError(t, got.Decode(b.Bytes()))
+		assert.Equal(t, b.Bytes(), got.Bytes())
+	})
+}
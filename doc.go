@@ -14,19 +14,67 @@
 // 	ok  	github.com/xlab/ziptools	16.792s
 //
 // Database should be created using a CSV file located at http://www.unitedstateszipcodes.org/zip_code_database.csv.
-// The gzipped version of that file with stripped CSV header is included within this package.
+// The gzipped version of that file with stripped CSV header is included within this package,
+// fresh downloads with a header are read by column names.
 //
-// The zipimport tool is suited for Bolt DB creation from that gzipped CSV.
+// The zipimport tool is suited for Bolt DB creation from that gzipped CSV. Inputs may also be
+// plain, zstd compressed or .zip archives, several files per flag are merged and "-" reads stdin.
+// Archives contribute their .csv, .txt, .tsv and .json files except readme files, or only the file
+// named as the archive if there is one, e.g. US.txt of a GeoNames US.zip.
 //
 //   $ zipimport -h
 //   Usage of zipimport:
-//     -zips="zip_code_database.csv.gz": gzipped .csv file with zip codes.
-//     -locodes="us_locode_database.csv.gz": gzipped .csv file with locodes.
+//     -zips=zip_code_database.csv.gz: .csv files with zip codes.
+//     -locodes=us_locode_database.csv.gz: .csv files with locodes.
+//     -zipcolumns="": optional column mapping of zips, e.g. zip=ZIP Code,primary_city=4.
+//     -locodecolumns="": optional column mapping of locodes, e.g. location=3,name=4.
+//     -columns="": optional .json file with column mappings of zips and locodes.
 //     -db="zipcodes.db": file to store a newly created zip codes database.
+//     -postalcodes=: optional .csv files with international postal codes.
+//     -geonames=: optional GeoNames postal code dumps.
+//     -usps=: optional USPS City State Product files.
+//     -aliases=false: index acceptable city aliases of zip codes as cities.
+//     -gazetteer=: optional Census Gazetteer ZCTA files with areas and coordinates.
+//     -hudcounty=: optional HUD USPS ZIP-COUNTY crosswalk .csv files.
+//     -zcta=: optional .geojson files with ZCTA boundaries.
+//     -report="": optional .json file to write the import report to, - for stdout.
+//     -strict=false: abort on the first problem with rows of zips, locodes and postal codes.
+//     -progress=true: show the progress of the import on stderr.
+//     -simplify=0.0001: tolerance in degrees to simplify ZCTA boundaries with.
+//     -geohash=7: precision of zip code geohashes, 1 to 12.
+//     -minsubstr=0: minimum length of indexed substrings of cities and codes.
+//     -maxsubstr=0: maximum length of indexed substrings of cities and codes, 0 for no limit.
+//     -prefixonly=false: index prefixes of cities and codes only.
+//     -maxpostings=0: maximum number of entries per indexed substring, 0 for no limit.
+//     -states="": comma separated list of states to import, e.g. NY,NJ.
+//     -ziptypes="": comma separated list of zip types to import, e.g. STANDARD,PO BOX.
+//     -zipprefixes="": comma separated list of zip prefixes to import, e.g. 100,112.
+//     -countries="": comma separated list of countries to import, e.g. US,CA.
+//     -bbox="": bounding box to import, as minLat,minLon,maxLat,maxLon.
+//     -functions="": UN/LOCODE functions that imported locodes must have, e.g. ---4----.
+//
+// The subset flags build a small database that only covers a service area, e.g. for edge
+// deployments or test fixtures.
+//
+// Every prefix and suffix of cities and codes is indexed by default. Substring limits shrink
+// the database for embedded use, searches fail with a QueryError for substrings they can't find.
+//
+// Every database records its schema version and the metadata of its build: the names and SHA-256
+// checksums of the source files, the build time, record counts and index options, see DB.Metadata
+// and zipsearch -meta. Open refuses databases of schema versions it doesn't understand.
+// Databases of earlier versions are still read, DB.Migrate and zipsearch -migrate upgrade
+// them in place without a new import; a dry run reports the changes first.
+//
+// Single records are changed without a new import as well: DB.PutZip, DB.DeleteZip, DB.PutLocation
+// and DB.DeleteLocation update the record along with every index derived from it in one transaction,
+// leaving the database as the importer would have built it. Substring lists truncated by
+// SubstringPolicy.MaxPostings are the exception, removals don't refill them.
 //
 // Installation and Examples
 //
-// After the Bolt database is created, you may remove zip_code_database.csv.gz.
+// After the Bolt database is created, you may remove zip_code_database.csv.gz. Rerunning zipimport
+// builds a new database and atomically replaces the previous one, readers never see a partial build.
+// Databases may be built within other programs as well, using the importer package that zipimport wraps.
 //
 //   go get https://github.com/xlab/ziptools/zipimport
 //   go get https://github.com/xlab/ziptools/zipsearch
@@ -41,6 +89,9 @@
 //     -city=false: given string is a city name or its part
 //     -db="zipcodes.db": specify zip codes database.
 //     -exact=false: look for exact match
+//     -meta=false: print the metadata of the database: sources, build time and counts
+//     -migrate=false: upgrade the database to the current schema version in place
+//     -dryrun=false: report what -migrate would change without changing the database
 // List all zipcodes in city:
 //   $ zipsearch -exact -city Richardson
 //   Zip codes in Richardson: [75080 75081 75082 75083 75085]
@@ -56,4 +107,9 @@
 // List all zips that match the given substring:
 //   $ zipsearch 1337
 //   Zip codes that match 1337: [01337 61337 91337]
+//
+// The zipexport tool writes zip code centroids and transport locations as a GeoJSON
+// FeatureCollection, optionally limited to states or a bounding box.
+//
+//   $ zipexport -locodes=false -states NY,NJ -out nynj.geojson
 package ziptools
@@ -0,0 +1,173 @@
+package ziptools
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// BBox represents a bounding box.
+type BBox struct {
+	Min Point
+	Max Point
+}
+
+// Contains reports whether the point lies within the bounding box.
+func (b BBox) Contains(lat, lon float64) bool {
+	return lat >= b.Min.Lat && lat <= b.Max.Lat &&
+		lon >= b.Min.Lon && lon <= b.Max.Lon
+}
+
+var errBBox = errors.New("ziptools: bbox must be minLat,minLon,maxLat,maxLon")
+
+// ParseBBox parses a bounding box given as minLat,minLon,maxLat,maxLon, e.g. by command flags.
+func ParseBBox(str string) (*BBox, error) {
+	parts := strings.Split(str, ",")
+	if len(parts) != 4 {
+		return nil, errBBox
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, errBBox
+		}
+		v[i] = f
+	}
+	return &BBox{
+		Min: Point{Lat: v[0], Lon: v[1]},
+		Max: Point{Lat: v[2], Lon: v[3]},
+	}, nil
+}
+
+// ExportFilter specifies which features to export.
+type ExportFilter struct {
+	// States limits the features to the specified states, all states if empty.
+	States []string
+	// BBox limits the features to the specified bounding box, if set.
+	BBox *BBox
+	// ExcludeZips skips the zip code centroids.
+	ExcludeZips bool
+	// ExcludeLocations skips the transport locations.
+	ExcludeLocations bool
+}
+
+func (f ExportFilter) match(state string, lat, lon float64) bool {
+	if f.BBox != nil && !f.BBox.Contains(lat, lon) {
+		return false
+	}
+	if len(f.States) == 0 {
+		return true
+	}
+	for _, s := range f.States {
+		if strings.EqualFold(s, state) {
+			return true
+		}
+	}
+	return false
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func newPointFeature(lat, lon float64, props map[string]interface{}) geoJSONFeature {
+	return geoJSONFeature{
+		Type: "Feature",
+		Geometry: geoJSONPoint{
+			Type:        "Point",
+			Coordinates: [2]float64{lon, lat},
+		},
+		Properties: props,
+	}
+}
+
+// ExportGeoJSON writes a GeoJSON FeatureCollection of zip code centroids and transport
+// locations that match the filter. Records without coordinates are skipped.
+// It returns the number of written features.
+func (d *DB) ExportGeoJSON(w io.Writer, filter ExportFilter) (n int, err error) {
+	out := bufio.NewWriter(w)
+	write := func(feat geoJSONFeature) error {
+		if n > 0 {
+			out.WriteString(",\n")
+		}
+		b, err := json.Marshal(feat)
+		if err != nil {
+			return err
+		}
+		out.Write(b)
+		n++
+		return nil
+	}
+	out.WriteString(`{"type":"FeatureCollection","features":[` + "\n")
+	if err = d.db.View(func(tx *bolt.Tx) error {
+		if !filter.ExcludeZips {
+			b := tx.Bucket(zipInfoBuck)
+			if b == nil {
+				return bolt.ErrBucketNotFound
+			}
+			if err := b.ForEach(func(k, v []byte) error {
+				var info ZipInfo
+				if err := info.Decode(v); err != nil {
+					return err
+				}
+				if !info.HasCoordinates() || !filter.match(info.State, info.Latitude, info.Longitude) {
+					return nil
+				}
+				return write(newPointFeature(info.Latitude, info.Longitude, map[string]interface{}{
+					"kind":       "zip",
+					"zip":        info.Zip,
+					"type":       info.Type,
+					"city":       info.City,
+					"state":      info.State,
+					"county":     info.County,
+					"timezone":   info.Timezone,
+					"population": info.Population,
+				}))
+			}); err != nil {
+				return err
+			}
+		}
+		if !filter.ExcludeLocations {
+			b := tx.Bucket(locationsBuck)
+			if b == nil {
+				return bolt.ErrBucketNotFound
+			}
+			if err := b.ForEach(func(k, v []byte) error {
+				var loc Location
+				if err := loc.Decode(v); err != nil {
+					return err
+				}
+				if !loc.HasCoordinates() || !filter.match(loc.State, loc.Latitude, loc.Longitude) {
+					return nil
+				}
+				return write(newPointFeature(loc.Latitude, loc.Longitude, map[string]interface{}{
+					"kind":      "locode",
+					"locode":    loc.Locode,
+					"city":      loc.Name,
+					"state":     loc.State,
+					"functions": loc.Functions,
+				}))
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+	out.WriteString("\n]}\n")
+	return n, out.Flush()
+}
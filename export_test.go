@@ -0,0 +1,72 @@
+package ziptools
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBBoxContains(t *testing.T) {
+	box := BBox{Min: Point{33, -94.2}, Max: Point{33.2, -94}}
+	assert.True(t, box.Contains(33.1, -94.15))
+	assert.True(t, box.Contains(33, -94))
+	assert.False(t, box.Contains(33.1, -93.9))
+}
+
+func TestParseBBox(t *testing.T) {
+	box, err := ParseBBox("33, -94.2,33.2,-94")
+	assert.NoError(t, err)
+	assert.Equal(t, &BBox{Min: Point{33, -94.2}, Max: Point{33.2, -94}}, box)
+	for _, str := range []string{"", "33,-94.2,33.2", "33,-94.2,33.2,x", "33,-94.2,33.2,-94,1"} {
+		_, err = ParseBBox(str)
+		assert.Error(t, err, str)
+	}
+}
+
+func TestExportGeoJSON(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	var buf bytes.Buffer
+	n, err := db.ExportGeoJSON(&buf, ExportFilter{
+		States:      []string{"tx"},
+		BBox:        &BBox{Min: Point{33, -94.2}, Max: Point{33.2, -94}},
+		ExcludeZips: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	var got struct {
+		Type     string
+		Features []struct {
+			Geometry struct {
+				Coordinates []float64
+			}
+			Properties map[string]interface{}
+		}
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "FeatureCollection", got.Type)
+	if assert.Len(t, got.Features, 2) {
+		assert.Equal(t, []float64{-94.15, 33.1}, got.Features[0].Geometry.Coordinates)
+		assert.Equal(t, "TAT", got.Features[0].Properties["locode"])
+		assert.Equal(t, "--3--6--", got.Features[0].Properties["functions"])
+	}
+}
+
+func TestExportGeoJSONEmpty(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	var buf bytes.Buffer
+	n, err := db.ExportGeoJSON(&buf, ExportFilter{States: []string{"XX"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.JSONEq(t, `{"type":"FeatureCollection","features":[]}`, buf.String())
+}
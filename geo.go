@@ -0,0 +1,271 @@
+package ziptools
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+)
+
+const (
+	// EarthRadius is the mean radius of the Earth in kilometers.
+	EarthRadius = 6371.0088
+	// CellSize is the size of a spatial grid cell in degrees.
+	CellSize = 1.0
+)
+
+// Function represents a set of UN/LOCODE function classifiers of a transport location.
+type Function uint8
+
+const (
+	// FunctionPort is a port, as defined in UN/ECE Recommendation 16.
+	FunctionPort Function = 1 << iota
+	// FunctionRail is a rail terminal.
+	FunctionRail
+	// FunctionRoad is a road terminal.
+	FunctionRoad
+	// FunctionAirport is an airport.
+	FunctionAirport
+	// FunctionPostal is a postal exchange office.
+	FunctionPostal
+	// FunctionMultimodal is a multimodal function, ICDs etc.
+	FunctionMultimodal
+	// FunctionFixed is a fixed transport function (e.g. oil platform).
+	FunctionFixed
+	// FunctionBorder is a border crossing.
+	FunctionBorder
+)
+
+// functionCodes are the classifier characters at their positions in a UN/LOCODE function string.
+const functionCodes = "1234567B"
+
+// ParseFunction constructs a function set from a UN/LOCODE function string, e.g. "--3--6--".
+func ParseFunction(str string) (f Function) {
+	for i, c := range []byte(str) {
+		if i >= len(functionCodes) {
+			return
+		}
+		if c == functionCodes[i] {
+			f |= 1 << uint(i)
+		}
+	}
+	return
+}
+
+// Has reports whether all functions of the given set are present.
+func (f Function) Has(fn Function) bool {
+	return f&fn == fn
+}
+
+// String represents a function set as a UN/LOCODE function string.
+func (f Function) String() string {
+	b := []byte("--------")
+	for i := range b {
+		if f&(1<<uint(i)) != 0 {
+			b[i] = functionCodes[i]
+		}
+	}
+	return string(b)
+}
+
+// MarshalJSON represents a function set as a string while marshaling as JSON.
+func (f Function) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+// UnmarshalJSON restores a function set from bytes after marshaling as JSON.
+func (f *Function) UnmarshalJSON(b []byte) (err error) {
+	var str string
+	if err = json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+	*f = ParseFunction(str)
+	return
+}
+
+// geohashBase32 is the alphabet of geohashes.
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// MaxGeohashPrecision is the maximal supported length of a geohash.
+const MaxGeohashPrecision = 12
+
+// Geohash encodes the point as a geohash of the given precision (length).
+func Geohash(lat, lon float64, precision int) string {
+	if precision < 1 {
+		precision = 1
+	} else if precision > MaxGeohashPrecision {
+		precision = MaxGeohashPrecision
+	}
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	hash := make([]byte, precision)
+	even := true
+	for i := range hash {
+		var idx byte
+		for bit := 0; bit < 5; bit++ {
+			rng, v := &latRange, lat
+			if even {
+				rng, v = &lonRange, lon
+			}
+			mid := (rng[0] + rng[1]) / 2
+			idx <<= 1
+			if v >= mid {
+				idx |= 1
+				rng[0] = mid
+			} else {
+				rng[1] = mid
+			}
+			even = !even
+		}
+		hash[i] = geohashBase32[idx]
+	}
+	return string(hash)
+}
+
+// Distance returns the great-circle distance in kilometers between two points.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	φ1 := lat1 * math.Pi / 180
+	φ2 := lat2 * math.Pi / 180
+	Δφ := (lat2 - lat1) * math.Pi / 180
+	Δλ := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(Δφ/2)*math.Sin(Δφ/2) +
+		math.Cos(φ1)*math.Cos(φ2)*math.Sin(Δλ/2)*math.Sin(Δλ/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Cell represents a cell of the spatial grid that is used to index coordinates.
+type Cell struct {
+	Lat uint16
+	Lon uint16
+}
+
+const (
+	cellRows = int(180 / CellSize)
+	cellCols = int(360 / CellSize)
+)
+
+// CellOf returns the grid cell that contains the specified point.
+func CellOf(lat, lon float64) Cell {
+	row := int(math.Floor((lat + 90) / CellSize))
+	col := int(math.Floor((lon + 180) / CellSize))
+	if row < 0 {
+		row = 0
+	} else if row >= cellRows {
+		row = cellRows - 1
+	}
+	col = ((col % cellCols) + cellCols) % cellCols
+	return Cell{Lat: uint16(row), Lon: uint16(col)}
+}
+
+// Bytes represents a cell as a sortable key. Cells of the same row are adjacent.
+//
+//  [lat uint16][lon uint16]
+func (c Cell) Bytes() []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint16(b[0:2], c.Lat)
+	binary.BigEndian.PutUint16(b[2:4], c.Lon)
+	return b
+}
+
+// Key returns a key that pairs the cell with a zip code, so a bucket
+// can hold any number of zip codes per cell.
+//
+//  [lat uint16][lon uint16][zip]
+func (c Cell) Key(z Zip) []byte {
+	return append(c.Bytes(), z[:]...)
+}
+
+// CoveringCells returns all cells that intersect with the bounding box.
+func CoveringCells(min, max Point) (cells []Cell) {
+	lo, hi := CellOf(min.Lat, min.Lon), CellOf(max.Lat, max.Lon)
+	for row := lo.Lat; row <= hi.Lat; row++ {
+		for col := lo.Lon; col <= hi.Lon; col++ {
+			cells = append(cells, Cell{Lat: row, Lon: col})
+		}
+	}
+	return
+}
+
+// searchRings visits the rings of cells around the point until done reports that
+// nothing closer than the bound can be found farther, or the whole grid is visited.
+func searchRings(lat, lon float64, visit func(Cell) error, done func(bound float64) bool) error {
+	center := CellOf(lat, lon)
+	for r := 0; r <= center.maxRing(); r++ {
+		if err := center.ring(r, visit); err != nil {
+			return err
+		}
+		if done(ringBound(lat, r)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// ring calls fn for each cell at the Chebyshev distance r from the cell.
+// Longitudes wrap around the antimeridian, rows out of the grid are skipped.
+func (c Cell) ring(r int, fn func(Cell) error) error {
+	visit := func(row, col int) error {
+		if row < 0 || row >= cellRows {
+			return nil
+		}
+		col = ((col % cellCols) + cellCols) % cellCols
+		return fn(Cell{Lat: uint16(row), Lon: uint16(col)})
+	}
+	row, col := int(c.Lat), int(c.Lon)
+	if r == 0 {
+		return visit(row, col)
+	}
+	width := 2*r + 1
+	if width > cellCols {
+		width = cellCols
+	}
+	for i := 0; i < width; i++ {
+		if err := visit(row-r, col-r+i); err != nil {
+			return err
+		}
+		if err := visit(row+r, col-r+i); err != nil {
+			return err
+		}
+	}
+	if 2*r > cellCols {
+		// no columns are that far away around the circle of latitude
+		return nil
+	}
+	for i := row - r + 1; i < row+r; i++ {
+		if err := visit(i, col-r); err != nil {
+			return err
+		}
+		if 2*r == cellCols {
+			// both sides meet at the opposite meridian
+			continue
+		}
+		if err := visit(i, col+r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ringBound returns the lower bound of a distance in kilometers from the point
+// to any point that is farther than r cells away from the point's cell.
+func ringBound(lat float64, r int) float64 {
+	margin := float64(r) * CellSize
+	maxLat := math.Abs(lat) + margin
+	if maxLat >= 90 {
+		return 0
+	}
+	byLat := margin * math.Pi / 180 * EarthRadius
+	byLon := 2 * EarthRadius * math.Cos(maxLat*math.Pi/180) * margin / 180
+	return math.Min(byLat, byLon)
+}
+
+// maxRing returns the ring number that covers the whole grid from the cell.
+func (c Cell) maxRing() int {
+	r := cellCols / 2
+	if n := int(c.Lat); n > r {
+		r = n
+	}
+	if n := cellRows - 1 - int(c.Lat); n > r {
+		r = n
+	}
+	return r
+}
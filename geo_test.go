@@ -0,0 +1,66 @@
+package ziptools
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFunction(t *testing.T) {
+	f := ParseFunction("-23--6-B")
+	assert.Equal(t, FunctionRail|FunctionRoad|FunctionMultimodal|FunctionBorder, f)
+	assert.Equal(t, "-23--6-B", f.String())
+	assert.True(t, f.Has(FunctionRail|FunctionRoad))
+	assert.False(t, f.Has(FunctionPort))
+	assert.True(t, f.Has(0))
+	assert.Equal(t, Function(0), ParseFunction(""))
+}
+
+func TestFunctionMarshalJSON(t *testing.T) {
+	out, err := json.Marshal(FunctionPort | FunctionAirport)
+	assert.NoError(t, err)
+	assert.Equal(t, `"1--4----"`, string(out))
+	var f Function
+	assert.NoError(t, json.Unmarshal(out, &f))
+	assert.Equal(t, FunctionPort|FunctionAirport, f)
+}
+
+func TestDistance(t *testing.T) {
+	// New York to Los Angeles
+	assert.InDelta(t, 3936, Distance(40.7128, -74.0060, 34.0522, -118.2437), 5)
+	assert.Equal(t, 0.0, Distance(33.1, -94.15, 33.1, -94.15))
+	// across the antimeridian
+	assert.InDelta(t, 22.2, Distance(0, 179.9, 0, -179.9), 0.1)
+}
+
+func TestCellOf(t *testing.T) {
+	assert.Equal(t, Cell{Lat: 123, Lon: 85}, CellOf(33.1, -94.15))
+	assert.Equal(t, Cell{Lat: 179, Lon: 0}, CellOf(90, 180))
+	assert.Equal(t, Cell{Lat: 0, Lon: 0}, CellOf(-90, -180))
+	assert.Equal(t, []byte{0, 123, 0, 85}, CellOf(33.1, -94.15).Bytes())
+}
+
+func TestCellRing(t *testing.T) {
+	var cells []Cell
+	collect := func(c Cell) error {
+		cells = append(cells, c)
+		return nil
+	}
+	CellOf(0, 0).ring(0, collect)
+	assert.Len(t, cells, 1)
+	cells = nil
+	CellOf(0, 0).ring(2, collect)
+	assert.Len(t, cells, 16)
+	cells = nil
+	// rows beyond the pole are skipped
+	CellOf(-90, 0).ring(1, collect)
+	assert.Len(t, cells, 5)
+}
+
+func TestGeohash(t *testing.T) {
+	assert.Equal(t, "u4pruydqqvj", Geohash(57.64911, 10.40744, 11))
+	assert.Equal(t, "dr9", Geohash(43.04, -76.14, 3))
+	assert.Equal(t, "d", Geohash(43.04, -76.14, 0))
+	assert.Len(t, Geohash(43.04, -76.14, 20), MaxGeohashPrecision)
+}
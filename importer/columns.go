@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// column describes a field of a CSV layout.
+type column struct {
+	// name of the field, used in column mappings.
+	name string
+	// headers are the known header names of the field, the name is always known.
+	headers []string
+	// pos is the position of the field in a file without header, -1 if absent.
+	pos      int
+	required bool
+}
+
+// layout describes the fields of a CSV file.
+type layout struct {
+	source  string
+	columns []column
+}
+
+// zipLayout is the layout of http://www.unitedstateszipcodes.org/zip_code_database.csv,
+// positions are the ones of the bundled file that has its header stripped.
+var zipLayout = layout{
+	source: "zips",
+	columns: []column{
+		{name: "zip", pos: 0, required: true},
+		{name: "type", pos: 1, required: true},
+		{name: "primary_city", pos: 2, required: true},
+		{name: "acceptable_cities", pos: 3},
+		{name: "state", pos: 5, required: true},
+		{name: "county", pos: 6},
+		{name: "timezone", pos: 7},
+		{name: "latitude", pos: 9},
+		{name: "longitude", pos: 10},
+		{name: "estimated_population", headers: []string{"irs_estimated_population"}, pos: 14},
+	},
+}
+
+// locodeLayout is the layout of UN/LOCODE code list in CSV.
+var locodeLayout = layout{
+	source: "locodes",
+	columns: []column{
+		{name: "country", pos: 1},
+		{name: "location", headers: []string{"locode"}, pos: 2, required: true},
+		{name: "name", pos: 3, required: true},
+		{name: "subdivision", headers: []string{"state"}, pos: 5, required: true},
+		{name: "function", pos: 6},
+		{name: "status", pos: 7},
+		{name: "coordinates", pos: 10},
+	},
+}
+
+// columnMap maps field names to indexes of columns in records.
+type columnMap map[string]int
+
+// get returns the value of a field in the record, empty if the field is absent.
+func (m columnMap) get(fields []string, name string) string {
+	if idx, ok := m[name]; ok && idx < len(fields) {
+		return fields[idx]
+	}
+	return ""
+}
+
+// width returns the minimal length of a record to hold all mapped fields.
+func (m columnMap) width() (n int) {
+	for _, idx := range m {
+		if idx+1 > n {
+			n = idx + 1
+		}
+	}
+	return
+}
+
+// isHeader reports whether a record is a header: it names a required field or a mapped column.
+func (l layout) isHeader(record []string, mapping map[string]string) bool {
+	for _, field := range record {
+		field = normalizeHeader(field)
+		for _, col := range mapping {
+			if field == normalizeHeader(col) {
+				return true
+			}
+		}
+		for _, c := range l.columns {
+			if !c.required {
+				continue
+			}
+			if field == c.name {
+				return true
+			}
+			for _, h := range c.headers {
+				if field == h {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// resolve builds a column map from the first record of a file. If the record is a header,
+// fields are found by their names, otherwise by default positions. The mapping overrides
+// either with header names or 1-based positions. It reports whether the record is a header.
+func (l layout) resolve(first []string, mapping map[string]string) (m columnMap, header bool, err error) {
+	if err = l.check(mapping); err != nil {
+		return
+	}
+	header = l.isHeader(first, mapping)
+	names := make(map[string]int)
+	if header {
+		for i, field := range first {
+			names[normalizeHeader(field)] = i
+		}
+	}
+	m = make(columnMap)
+	for _, c := range l.columns {
+		idx := -1
+		if col, ok := mapping[c.name]; ok {
+			if pos, err := strconv.Atoi(col); err == nil {
+				idx = pos - 1
+			} else if i, ok := names[normalizeHeader(col)]; ok {
+				idx = i
+			} else if header {
+				return nil, false, fmt.Errorf("importer: %s: no column %q for field %s in header", l.source, col, c.name)
+			} else {
+				return nil, false, fmt.Errorf("importer: %s: file has no header, map field %s to a position", l.source, c.name)
+			}
+		} else if header {
+			for _, h := range append([]string{c.name}, c.headers...) {
+				if i, ok := names[h]; ok {
+					idx = i
+					break
+				}
+			}
+		} else {
+			idx = c.pos
+		}
+		if idx < 0 {
+			if c.required {
+				return nil, false, fmt.Errorf("importer: %s: no column for field %s in header %q", l.source, c.name, strings.Join(first, ","))
+			}
+			continue
+		}
+		m[c.name] = idx
+	}
+	if !header && len(first) < m.width() {
+		return nil, false, fmt.Errorf("importer: %s: file has %d columns but its layout needs %d, provide a header or a column mapping",
+			l.source, len(first), m.width())
+	}
+	return
+}
+
+// check checks that the mapping names fields of the layout.
+func (l layout) check(mapping map[string]string) error {
+	for name := range mapping {
+		if !l.has(name) {
+			return fmt.Errorf("importer: %s: unknown field %q in column mapping", l.source, name)
+		}
+	}
+	return nil
+}
+
+// fields returns the names of fields of the layout.
+func (l layout) fields() []string {
+	names := make([]string, 0, len(l.columns))
+	for _, c := range l.columns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+func (l layout) has(name string) bool {
+	for _, c := range l.columns {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeHeader(str string) string {
+	str = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(str, "\ufeff")))
+	return strings.Replace(str, " ", "_", -1)
+}
+
+// readLayout reads the first record of a CSV file and resolves the column map of the layout.
+// It returns the first record if it holds data rather than a header.
+func readLayout(csv *csv.Reader, l layout, mapping map[string]string) (m columnMap, first []string, err error) {
+	csv.FieldsPerRecord = -1
+	if first, err = csv.Read(); err != nil {
+		if err == io.EOF {
+			return columnMap{}, nil, nil
+		}
+		return nil, nil, fmt.Errorf("importer: %s: %v", l.source, err)
+	}
+	m, header, err := l.resolve(first, mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header {
+		first = nil
+	}
+	return m, first, nil
+}
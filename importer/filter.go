@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools"
+)
+
+// Filter limits a build to a subset of the inputs, e.g. the service area of a regional deployment.
+// Every field that is set must match, empty fields match everything. Fields apply to the kinds of
+// rows that have them: zip codes are in the US and have types, locations have functions.
+type Filter struct {
+	// States keeps the zip codes, locations and postal codes of the states, e.g. "NY".
+	States []string
+	// ZipTypes keeps the zip codes of the types, e.g. "STANDARD" or "PO BOX".
+	ZipTypes []string
+	// ZipPrefixes keeps the zip codes that start with any of the prefixes, e.g. "100".
+	ZipPrefixes []string
+	// Countries keeps the zip codes, locations and postal codes of the countries, e.g. "US".
+	// Locations without a country column are in the US, like the bundled ones.
+	Countries []string
+	// BBox keeps the rows within the bounding box, rows without coordinates are left out.
+	BBox *ziptools.BBox
+	// Functions keeps the locations that have all of the functions.
+	Functions ziptools.Function
+}
+
+// IsZero reports whether the filter keeps everything.
+func (f Filter) IsZero() bool {
+	return len(f.States) == 0 && len(f.ZipTypes) == 0 && len(f.ZipPrefixes) == 0 &&
+		len(f.Countries) == 0 && f.BBox == nil && f.Functions == 0
+}
+
+// zip returns the reason to leave out the zip code, empty if it's kept.
+func (f Filter) zip(info ziptools.ZipInfo) string {
+	switch {
+	case !matchAny(f.Countries, ziptools.CountryUS, strings.EqualFold):
+		return "filtered by country"
+	case !matchAny(f.States, info.State, strings.EqualFold):
+		return "filtered by state"
+	case !matchAny(f.ZipTypes, info.Type, strings.EqualFold):
+		return "filtered by zip type"
+	case !matchAny(f.ZipPrefixes, info.Zip.String(), strings.HasPrefix):
+		return "filtered by zip prefix"
+	case !f.contains(info.Latitude, info.Longitude):
+		return "filtered by bbox"
+	}
+	return ""
+}
+
+// location returns the reason to leave out the location, empty if it's kept.
+func (f Filter) location(country string, loc ziptools.Location) string {
+	if len(country) == 0 {
+		country = ziptools.CountryUS
+	}
+	switch {
+	case !matchAny(f.Countries, country, strings.EqualFold):
+		return "filtered by country"
+	case !matchAny(f.States, loc.State, strings.EqualFold):
+		return "filtered by state"
+	case !loc.Functions.Has(f.Functions):
+		return "filtered by function"
+	case !f.contains(loc.Latitude, loc.Longitude):
+		return "filtered by bbox"
+	}
+	return ""
+}
+
+// postalCode returns the reason to leave out the postal code, empty if it's kept.
+func (f Filter) postalCode(info ziptools.PostalCodeInfo) string {
+	switch {
+	case !matchAny(f.Countries, info.PostalCode.Country, strings.EqualFold):
+		return "filtered by country"
+	case !matchAny(f.States, info.State, strings.EqualFold):
+		return "filtered by state"
+	case !f.contains(info.Latitude, info.Longitude):
+		return "filtered by bbox"
+	}
+	return ""
+}
+
+// contains reports whether the bounding box contains the coordinates, zeros are no coordinates.
+func (f Filter) contains(lat, lon float64) bool {
+	if f.BBox == nil {
+		return true
+	}
+	if lat == 0 && lon == 0 {
+		return false
+	}
+	return f.BBox.Contains(lat, lon)
+}
+
+// matchAny reports whether the value matches any of the patterns, an empty list matches everything.
+func matchAny(patterns []string, value string, match func(value, pattern string) bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if match(value, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasZip reports whether data keyed by the zip code is kept, i.e. the build isn't filtered
+// or the zip code is imported.
+func (d *builder) hasZip(tx *bolt.Tx, zip ziptools.Zip) bool {
+	if d.opts.Filter.IsZero() {
+		return true
+	}
+	b := tx.Bucket(zipsBuck)
+	return b != nil && b.Get(zip.Bytes()) != nil
+}
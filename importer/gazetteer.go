@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xlab/ziptools"
+)
+
+// gazetteerColumns are the required columns of a Census Gazetteer ZCTA file.
+var gazetteerColumns = []string{"GEOID", "ALAND", "AWATER", "INTPTLAT", "INTPTLONG"}
+
+// addGazetteer reads a tab-delimited Census Gazetteer ZCTA file and merges land area,
+// water area and internal point coordinates into the zip codes imported already.
+func (d *builder) addGazetteer(r io.Reader) (n int, err error) {
+	tsv := csv.NewReader(r)
+	tsv.Comma = '\t'
+	tsv.FieldsPerRecord = -1
+	tsv.TrimLeadingSpace = true
+
+	header, err := tsv.Read()
+	if err != nil {
+		return
+	}
+	idx, err := headerIndex(header, gazetteerColumns, "Census Gazetteer")
+	if err != nil {
+		return
+	}
+
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var zips *zipBuckets
+	if zips, err = d.createZipBuckets(tx); err != nil {
+		return
+	}
+	var unknown int
+	for {
+		var fields []string
+		fields, err = tsv.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if failed := readFailed(d.progress.Input, err); failed != nil {
+				return n, failed
+			}
+			d.logln("importer: ignored a Census Gazetteer line due to an error", err)
+			// rows that can't be read count as well, so cancellation is checked on every row
+			if err = d.tick(); err != nil {
+				return
+			}
+			continue
+		}
+		if err = d.tick(); err != nil {
+			return
+		}
+		get := func(col int) string {
+			if idx[col] >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[idx[col]])
+		}
+		info, ok := zips.get(ziptools.NewZip(get(0)))
+		if !ok {
+			unknown++
+			continue
+		}
+		land, err1 := strconv.ParseInt(get(1), 10, 64)
+		water, err2 := strconv.ParseInt(get(2), 10, 64)
+		lat, err3 := strconv.ParseFloat(get(3), 64)
+		lon, err4 := strconv.ParseFloat(get(4), 64)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			d.logln("importer: ignored a Census Gazetteer line with malformed values", get(0))
+			continue
+		}
+		info.LandArea, info.WaterArea = land, water
+		info.Latitude, info.Longitude = lat, lon
+		if len(d.opts.Filter.zip(info)) > 0 {
+			// the zip code has moved out of the bounding box
+			if err = zips.delete(info.Zip); err != nil {
+				return
+			}
+			continue
+		}
+		if err = zips.put(info); err != nil {
+			return
+		}
+		n++
+	}
+	if unknown > 0 {
+		d.logf("importer: %d Census Gazetteer ZCTAs have no matching zip code", unknown)
+	}
+	return n, tx.Commit()
+}
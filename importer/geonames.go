@@ -0,0 +1,123 @@
+package importer
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools"
+)
+
+// GeoNames postal code dump columns, see http://download.geonames.org/export/zip/readme.txt
+const (
+	geoCountry = iota
+	geoPostalCode
+	geoPlaceName
+	geoAdminName1
+	geoAdminCode1
+	geoAdminName2
+	geoAdminCode2
+	geoAdminName3
+	geoAdminCode3
+	geoLatitude
+	geoLongitude
+	geoAccuracy
+	geoColumns
+)
+
+// addGeoNames reads a tab-separated GeoNames postal code dump, e.g. allCountries.txt or US.txt.
+// US codes are put as zip codes unless imported already, other codes become postal codes.
+// A postal code may be listed for several places, the first one is kept.
+func (d *builder) addGeoNames(r io.Reader) (n int, err error) {
+	tsv := csv.NewReader(r)
+	tsv.Comma = '\t'
+	tsv.LazyQuotes = true
+	tsv.FieldsPerRecord = -1
+
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var zips *zipBuckets
+	var codes *bolt.Bucket
+	if zips, err = d.createZipBuckets(tx); err != nil {
+		return
+	}
+	if codes, err = tx.CreateBucketIfNotExists(postalCodesBuck); err != nil {
+		return
+	}
+	for {
+		var fields []string
+		fields, err = tsv.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if failed := readFailed(d.progress.Input, err); failed != nil {
+				return n, failed
+			}
+			d.logln("importer: ignored a GeoNames line due to an error", err)
+			// rows that can't be read count as well, so cancellation is checked on every row
+			if err = d.tick(); err != nil {
+				return
+			}
+			continue
+		}
+		if err = d.tick(); err != nil {
+			return
+		}
+		if len(fields) < geoColumns-1 {
+			d.logln("importer: ignored a GeoNames line with too few columns")
+			continue
+		}
+		info := ziptools.PostalCodeInfo{
+			PostalCode: ziptools.NewPostalCode(fields[geoCountry], fields[geoPostalCode]),
+			City:       fields[geoPlaceName],
+			State:      fields[geoAdminCode1],
+			County:     fields[geoAdminName2],
+		}
+		if len(info.PostalCode.Country) == 0 || len(info.PostalCode.Code) == 0 {
+			d.logln("importer: ignored a GeoNames line without a country or a postal code")
+			continue
+		}
+		if len(info.State) == 0 {
+			info.State = fields[geoAdminName1]
+		}
+		info.Latitude, _ = strconv.ParseFloat(fields[geoLatitude], 64)
+		info.Longitude, _ = strconv.ParseFloat(fields[geoLongitude], 64)
+
+		if info.PostalCode.IsZip() {
+			zip := info.PostalCode.Zip()
+			if len(info.PostalCode.Code) != ziptools.ZipLen || zips.has(zip) {
+				continue
+			}
+			zipInfo := ziptools.ZipInfo{
+				Zip:       zip,
+				City:      info.City,
+				State:     info.State,
+				County:    info.County,
+				Latitude:  info.Latitude,
+				Longitude: info.Longitude,
+			}
+			if len(d.opts.Filter.zip(zipInfo)) > 0 {
+				continue
+			}
+			if err = zips.put(zipInfo); err != nil {
+				return
+			}
+			n++
+			continue
+		}
+		if codes.Get(info.PostalCode.Key()) != nil || len(d.opts.Filter.postalCode(info)) > 0 {
+			continue
+		}
+		if err = d.putPostalCode(codes, info); err != nil {
+			return
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
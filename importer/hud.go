@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools"
+)
+
+// hudColumns are the required columns of a HUD USPS ZIP-COUNTY crosswalk file.
+var hudColumns = []string{"ZIP", "COUNTY", "RES_RATIO", "BUS_RATIO", "OTH_RATIO", "TOT_RATIO"}
+
+// addCountyShares reads a HUD USPS ZIP-COUNTY crosswalk and puts the weighted list
+// of counties per zip code, ordered by the total ratio.
+func (d *builder) addCountyShares(csv *csv.Reader) (n int, err error) {
+	csv.FieldsPerRecord = -1
+	header, err := csv.Read()
+	if err != nil {
+		return
+	}
+	idx, err := headerIndex(header, hudColumns, "HUD ZIP-COUNTY")
+	if err != nil {
+		return
+	}
+
+	var zips []ziptools.Zip
+	shares := make(map[ziptools.Zip]ziptools.CountyShareList)
+	for {
+		var fields []string
+		fields, err = csv.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if failed := readFailed(d.progress.Input, err); failed != nil {
+				return n, failed
+			}
+			d.logln("importer: ignored a HUD ZIP-COUNTY line due to an error", err)
+			// rows that can't be read count as well, so cancellation is checked on every row
+			if err = d.tick(); err != nil {
+				return
+			}
+			continue
+		}
+		if err = d.tick(); err != nil {
+			return
+		}
+		get := func(col int) string {
+			if idx[col] >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[idx[col]])
+		}
+		var ratios [4]float64
+		var malformed bool
+		for i := range ratios {
+			if ratios[i], err = strconv.ParseFloat(get(i+2), 64); err != nil {
+				malformed = true
+			}
+		}
+		zip, county := get(0), get(1)
+		if malformed || len(zip) != ziptools.ZipLen || len(county) == 0 {
+			d.logln("importer: ignored a HUD ZIP-COUNTY line with malformed values", zip)
+			continue
+		}
+		z := ziptools.NewZip(zip)
+		if _, ok := shares[z]; !ok {
+			zips = append(zips, z)
+		}
+		shares[z] = append(shares[z], ziptools.CountyShare{
+			County:      county,
+			Residential: ratios[0],
+			Business:    ratios[1],
+			Other:       ratios[2],
+			Total:       ratios[3],
+		})
+	}
+
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var buck *bolt.Bucket
+	if buck, err = tx.CreateBucketIfNotExists(countySharesBuck); err != nil {
+		return
+	}
+	for _, zip := range zips {
+		if !d.hasZip(tx, zip) {
+			continue
+		}
+		list := shares[zip]
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Total > list[j].Total
+		})
+		// zip = county shares
+		if err = buck.Put(zip.Bytes(), list.Bytes()); err != nil {
+			return
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
@@ -0,0 +1,966 @@
+// Package importer builds zip code databases for the ziptools package.
+//
+// A database is built from CSV files with zip codes and UN/LOCODE locations, optionally enriched
+// with international postal codes, GeoNames dumps, USPS City State Product files, Census Gazetteer
+// and HUD ZIP-COUNTY files and ZCTA boundaries. Inputs are readers that may be plain, gzip or zstd
+// compressed. The database is built in a temporary file next to the destination and renamed over it
+// once complete, readers never see a partial build.
+//
+//  imp := importer.New(importer.Options{
+//  	Zips:    []importer.Input{{Name: "zips.csv", Reader: zips}},
+//  	Locodes: []importer.Input{{Name: "locodes.csv", Reader: locodes}},
+//  })
+//  report, err := imp.Build(ctx, "zipcodes.db")
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools"
+	"github.com/xlab/ziptools/internal/buckets"
+)
+
+var (
+	citiesBuck         = buckets.Cities
+	zipsBuck           = buckets.Zips
+	locodesBuck        = buckets.Locodes
+	locationsBuck      = buckets.Locations
+	subZipsBuck        = buckets.SubZips
+	subCitiesBuck      = buckets.SubCities
+	subLocodesBuck     = buckets.SubLocodes
+	locodeCellsBuck    = buckets.LocodeCells
+	zipInfoBuck        = buckets.ZipInfo
+	zipCellsBuck       = buckets.ZipCells
+	boundariesBuck     = buckets.Boundaries
+	boundaryCellsBuck  = buckets.BoundaryCells
+	geohashesBuck      = buckets.Geohashes
+	zipGeohashesBuck   = buckets.ZipGeohashes
+	cityInfoBuck       = buckets.CityInfo
+	postalCodesBuck    = buckets.PostalCodes
+	postalCitiesBuck   = buckets.PostalCities
+	subPostalCodesBuck = buckets.SubPostalCodes
+	countySharesBuck   = buckets.CountyShares
+	cityCasesBuck      = buckets.CityCases
+	metaBuck           = buckets.Meta
+)
+
+const (
+	// DefaultGeohashPrecision is the precision of zip code geohashes unless set.
+	DefaultGeohashPrecision = 7
+	// DefaultSimplify is the tolerance in degrees suited to simplify ZCTA boundaries with.
+	DefaultSimplify = 0.0001
+)
+
+// Fields of the CSV files with zip codes and locodes, see Options.ZipColumns and Options.LocodeColumns.
+var (
+	ZipFields    = zipLayout.fields()
+	LocodeFields = locodeLayout.fields()
+)
+
+// Input is a named source of data, it may be plain, gzip or zstd compressed.
+type Input struct {
+	// Name identifies the input in the report and in logs, e.g. a file name.
+	Name   string
+	Reader io.Reader
+	// Size is the size of the reader in bytes if known, it estimates the total of rows.
+	Size int64
+}
+
+// Options configure a build. Inputs of a kind are merged in order,
+// later inputs replace the zip codes of earlier ones.
+type Options struct {
+	// Zips are CSV files with zip codes, e.g. http://www.unitedstateszipcodes.org/zip_code_database.csv.
+	// A file may start with a header, columns are found by their names then. Files without a header
+	// must follow the layout of the file bundled with ziptools.
+	Zips []Input
+	// Locodes are CSV files of the UN/LOCODE code list.
+	Locodes []Input
+	// PostalCodes are CSV files with international postal codes, columns are
+	// country, postal code, city, state, county, latitude, longitude; the last three are optional.
+	PostalCodes []Input
+	// GeoNames are tab-separated GeoNames postal code dumps.
+	GeoNames []Input
+	// USPS are USPS City State Product files.
+	USPS []Input
+	// Gazetteer are Census Gazetteer ZCTA files with areas and coordinates.
+	Gazetteer []Input
+	// HUDCounty are HUD USPS ZIP-COUNTY crosswalk CSV files.
+	HUDCounty []Input
+	// ZCTA are GeoJSON files with ZCTA boundaries.
+	ZCTA []Input
+
+	// ZipColumns maps fields of zips to columns by a header name or a 1-based position.
+	ZipColumns map[string]string
+	// LocodeColumns maps fields of locodes to columns by a header name or a 1-based position.
+	LocodeColumns map[string]string
+
+	// IndexAliases indexes acceptable city aliases of zip codes as cities.
+	IndexAliases bool
+	// Filter limits the build to a subset of the inputs, e.g. a service area.
+	Filter Filter
+	// Substrings limits the substrings of cities, zip codes and postal codes that are indexed,
+	// the zero policy indexes every prefix and every suffix. It's recorded in the database.
+	Substrings ziptools.SubstringPolicy
+	// Simplify is the tolerance in degrees to simplify ZCTA boundaries with, zero keeps them intact.
+	Simplify float64
+	// GeohashPrecision is the precision of zip code geohashes, 1 to 12; zero means DefaultGeohashPrecision.
+	GeohashPrecision int
+	// Strict aborts on the first problem with rows of zips, locodes and postal codes.
+	Strict bool
+	// Logf logs the progress of a build, nil disables logging.
+	Logf func(format string, v ...interface{})
+	// Progress is called at the beginning and the end of every phase and every few rows in between.
+	Progress func(p Progress)
+}
+
+// Importer builds zip code databases.
+type Importer struct {
+	opts Options
+}
+
+// New creates a new importer with the options.
+func New(opts Options) *Importer {
+	if opts.GeohashPrecision == 0 {
+		opts.GeohashPrecision = DefaultGeohashPrecision
+	}
+	return &Importer{opts: opts}
+}
+
+// Build imports the inputs, builds every index and atomically replaces the database at dst.
+// The report is returned even if the build fails, e.g. in the strict mode. A cancellation of
+// the context aborts the build and removes the partial database, dst is left intact.
+func (i *Importer) Build(ctx context.Context, dst string) (rpt *Report, err error) {
+	rpt = &Report{Strict: i.opts.Strict}
+	if i.opts.GeohashPrecision < 1 || i.opts.GeohashPrecision > ziptools.MaxGeohashPrecision {
+		return rpt, fmt.Errorf("importer: geohash precision must be within 1 to %d", ziptools.MaxGeohashPrecision)
+	}
+	if err = i.opts.Substrings.Check(); err != nil {
+		return
+	}
+	if err = zipLayout.check(i.opts.ZipColumns); err != nil {
+		return
+	}
+	if err = locodeLayout.check(i.opts.LocodeColumns); err != nil {
+		return
+	}
+
+	// build the DB in a temporary file, it replaces the DB file once complete
+	tmpPath, err := tempFile(dst)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+	d := &builder{ctx: ctx, opts: &i.opts, report: rpt}
+	if d.db, err = bolt.Open(tmpPath, 0644, nil); err != nil {
+		return
+	}
+	if err = d.build(); err != nil {
+		d.db.Close()
+		return
+	}
+	if err = d.db.Close(); err != nil {
+		return
+	}
+	if err = replaceFile(tmpPath, dst); err != nil {
+		return
+	}
+	d.logf("importer: database written to %s", dst)
+	return
+}
+
+// builder builds a database in a Bolt file.
+type builder struct {
+	db     *bolt.DB
+	ctx    context.Context
+	opts   *Options
+	report *Report
+
+	// sources are the inputs imported so far
+	sources  []ziptools.Source
+	progress Progress
+	// input of the phase and its size
+	input *countingReader
+	size  int64
+}
+
+func (d *builder) logf(format string, v ...interface{}) {
+	if d.opts.Logf != nil {
+		d.opts.Logf(format, v...)
+	}
+}
+
+func (d *builder) logln(v ...interface{}) {
+	if d.opts.Logf != nil {
+		d.opts.Logf("%s", strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+	}
+}
+
+// forEach calls fn with each of the inputs decompressed, every input is a phase.
+func (d *builder) forEach(inputs []Input, phase, bucket string, fn func(name string, r io.Reader) (int, error), format string) error {
+	for _, in := range inputs {
+		if err := d.ctx.Err(); err != nil {
+			return err
+		}
+		hash := sha256.New()
+		counter := &countingReader{Reader: io.TeeReader(in.Reader, hash)}
+		d.begin(phase, in.Name, bucket, counter, in.Size, 0)
+		if err := decompress(in.Name, counter, func(r io.Reader) error {
+			n, err := fn(in.Name, r)
+			if err == nil {
+				d.end()
+				d.logf(format, n, in.Name)
+			}
+			return err
+		}); err != nil {
+			return err
+		}
+		// the checksum covers the whole file, decompressors may stop short of its end
+		if _, err := io.Copy(ioutil.Discard, counter); err != nil {
+			return err
+		}
+		d.sources = append(d.sources, ziptools.Source{
+			Kind:   phase,
+			Name:   in.Name,
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+			Size:   counter.n,
+		})
+	}
+	return nil
+}
+
+// build imports the inputs and builds every index.
+func (d *builder) build() (err error) {
+	if err = d.forEach(d.opts.Zips, zipLayout.source, string(zipInfoBuck), func(name string, r io.Reader) (int, error) {
+		return d.addZips(csv.NewReader(r), d.report.add(zipLayout.source, name))
+	}, "importer: %d zip codes imported from %s"); err != nil {
+		return
+	}
+	if err = d.forEach(d.opts.Locodes, locodeLayout.source, string(locationsBuck), func(name string, r io.Reader) (int, error) {
+		return d.addLocations(csv.NewReader(r), d.report.add(locodeLayout.source, name))
+	}, "importer: %d locations imported from %s"); err != nil {
+		return
+	}
+	if err = d.forEach(d.opts.PostalCodes, "postalcodes", string(postalCodesBuck), func(name string, r io.Reader) (int, error) {
+		return d.addPostalCodes(csv.NewReader(r), d.report.add("postalcodes", name))
+	}, "importer: %d postal codes imported from %s"); err != nil {
+		return
+	}
+	if err = d.forEach(d.opts.GeoNames, "geonames", string(zipInfoBuck), func(name string, r io.Reader) (int, error) {
+		return d.addGeoNames(r)
+	}, "importer: %d GeoNames postal codes imported from %s"); err != nil {
+		return
+	}
+	if err = d.forEach(d.opts.USPS, "usps", string(zipInfoBuck), func(name string, r io.Reader) (int, error) {
+		return d.addCityStateProduct(r, d.report.add("usps", name))
+	}, "importer: %d zip codes imported from USPS City State Product %s"); err != nil {
+		return
+	}
+	if err = d.forEach(d.opts.Gazetteer, "gazetteer", string(zipInfoBuck), func(name string, r io.Reader) (int, error) {
+		return d.addGazetteer(r)
+	}, "importer: %d zip codes merged with Census Gazetteer %s"); err != nil {
+		return
+	}
+	if err = d.forEach(d.opts.HUDCounty, "hudcounty", string(countySharesBuck), func(name string, r io.Reader) (int, error) {
+		return d.addCountyShares(csv.NewReader(r))
+	}, "importer: %d zip codes apportioned to counties from %s"); err != nil {
+		return
+	}
+	if err = d.forEach(d.opts.ZCTA, "zcta", string(boundariesBuck), func(name string, r io.Reader) (int, error) {
+		return d.addBoundaries(r)
+	}, "importer: %d ZCTA boundaries imported from %s"); err != nil {
+		return
+	}
+
+	if err = d.addLocodes(); err != nil {
+		return
+	}
+	if err = d.addSubstrings(); err != nil {
+		return
+	}
+	if err = d.addPostalSubstrings(); err != nil {
+		return
+	}
+	var n int
+	if n, err = d.addCityInfo(); err != nil {
+		return
+	}
+	d.logf("importer: %d cities aggregated", n)
+	if err = d.addMeta(); err != nil {
+		return
+	}
+	d.logln("importer: done indexing")
+	return
+}
+
+// addMeta records the schema version, the substring policy the database is indexed with
+// and the metadata of the build.
+func (d *builder) addMeta() error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		meta := ziptools.Metadata{
+			SchemaVersion: ziptools.SchemaVersion,
+			Built:         time.Now().UTC().Truncate(time.Second),
+			Sources:       d.sources,
+			Counts:        make(map[string]int),
+			Index: ziptools.IndexOptions{
+				Substrings:       d.opts.Substrings,
+				Aliases:          d.opts.IndexAliases,
+				GeohashPrecision: d.opts.GeohashPrecision,
+				Simplify:         d.opts.Simplify,
+			},
+		}
+		if err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			meta.Counts[string(name)] = b.Stats().KeyN
+			return nil
+		}); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucketIfNotExists(metaBuck)
+		if err != nil {
+			return err
+		}
+		if err = b.Put(buckets.MetaSchema, []byte(strconv.Itoa(ziptools.SchemaVersion))); err != nil {
+			return err
+		}
+		if err = b.Put(buckets.MetaSubstrings, d.opts.Substrings.Bytes()); err != nil {
+			return err
+		}
+		return b.Put(buckets.MetaDataset, meta.Bytes())
+	})
+}
+
+func (d *builder) addLocations(csv *csv.Reader, rep *SourceReport) (n int, err error) {
+	cols, first, err := readLayout(csv, locodeLayout, d.opts.LocodeColumns)
+	if err != nil {
+		return
+	}
+	if first != nil && len(cols.get(first, "location")) != ziptools.LocodeLen {
+		return 0, fmt.Errorf("importer: locodes: first line doesn't match the layout, got location %q", cols.get(first, "location"))
+	}
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var locations *bolt.Bucket
+	if locations, err = tx.CreateBucketIfNotExists(locationsBuck); err != nil {
+		return
+	}
+	seen := make(map[string]struct{})
+	for {
+		fields := first
+		if fields == nil {
+			fields, err = csv.Read()
+		}
+		first = nil
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// rows that can't be read count as well, so cancellation is checked on every row
+			if err = rep.readError(err); err == nil {
+				err = d.tick()
+			}
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if err = d.tick(); err != nil {
+			return
+		}
+		line := lineOf(csv)
+		if len(fields) < cols.width() {
+			if err = rep.malformed(line, "too few columns"); err != nil {
+				return
+			}
+			continue
+		}
+		locode := cols.get(fields, "location")
+		if len(locode) != ziptools.LocodeLen {
+			if err = rep.malformed(line, fmt.Sprintf("invalid locode %q", locode)); err != nil {
+				return
+			}
+			continue
+		}
+		switch status := cols.get(fields, "status"); status {
+		case "RR", "QQ", "XX":
+			rep.skip("status " + status)
+			continue
+		}
+		coordinates := cols.get(fields, "coordinates")
+		location := ziptools.Location{
+			State:     cols.get(fields, "subdivision"),
+			Locode:    ziptools.NewLocode(cols.get(fields, "location")),
+			Functions: ziptools.ParseFunction(cols.get(fields, "function")),
+		}
+		var ok bool
+		location.Latitude, location.Longitude, ok = parseCoordinates(coordinates)
+		if reason := d.opts.Filter.location(cols.get(fields, "country"), location); len(reason) > 0 {
+			rep.skip(reason)
+			continue
+		}
+		if _, ok := seen[locode]; ok {
+			if err = rep.duplicate(line, "locode "+locode); err != nil {
+				return
+			}
+		}
+		seen[locode] = struct{}{}
+		if !ok && len(coordinates) > 0 {
+			if err = rep.invalid(line, fmt.Sprintf("invalid coordinates %q", coordinates)); err != nil {
+				return
+			}
+		}
+		name := cols.get(fields, "name")
+		if idx := strings.Index(name, "/"); idx < 0 {
+			location.Name = name
+		} else {
+			location.Name = name[:idx]
+		}
+		// locode = location
+		if err = locations.Put(location.Locode.Bytes(), location.Bytes()); err != nil {
+			return
+		}
+		rep.accept()
+		n++
+	}
+	return n, tx.Commit()
+}
+
+func (d *builder) addZips(csv *csv.Reader, rep *SourceReport) (n int, err error) {
+	cols, first, err := readLayout(csv, zipLayout, d.opts.ZipColumns)
+	if err != nil {
+		return
+	}
+	if first != nil && !isZip(cols.get(first, "zip")) {
+		return 0, fmt.Errorf("importer: zips: first line doesn't match the layout, got zip %q", cols.get(first, "zip"))
+	}
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var zips *zipBuckets
+	if zips, err = d.createZipBuckets(tx); err != nil {
+		return
+	}
+
+	seen := make(map[ziptools.Zip]struct{})
+	for {
+		fields := first
+		if fields == nil {
+			fields, err = csv.Read()
+		}
+		first = nil
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// rows that can't be read count as well, so cancellation is checked on every row
+			if err = rep.readError(err); err == nil {
+				err = d.tick()
+			}
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if err = d.tick(); err != nil {
+			return
+		}
+		line := lineOf(csv)
+		if len(fields) < cols.width() {
+			if err = rep.malformed(line, "too few columns"); err != nil {
+				return
+			}
+			continue
+		}
+		if zip := cols.get(fields, "zip"); !isZip(zip) {
+			if err = rep.malformed(line, fmt.Sprintf("invalid zip %q", zip)); err != nil {
+				return
+			}
+			continue
+		}
+		if cols.get(fields, "type") == "MILITARY" {
+			rep.skip("military zip")
+			continue
+		}
+		zip := ziptools.NewZip(cols.get(fields, "zip"))
+		info := ziptools.ZipInfo{
+			Zip:      zip,
+			Type:     cols.get(fields, "type"),
+			City:     cols.get(fields, "primary_city"),
+			State:    cols.get(fields, "state"),
+			County:   cols.get(fields, "county"),
+			Timezone: cols.get(fields, "timezone"),
+		}
+		invalid := parseZipNumbers(&info, cols, fields)
+		if reason := d.opts.Filter.zip(info); len(reason) > 0 {
+			rep.skip(reason)
+			continue
+		}
+		if _, ok := seen[zip]; ok {
+			if err = rep.duplicate(line, "zip "+zip.String()); err != nil {
+				return
+			}
+		}
+		seen[zip] = struct{}{}
+		if len(invalid) > 0 {
+			if err = rep.invalid(line, invalid); err != nil {
+				return
+			}
+		}
+		for _, alias := range strings.Split(cols.get(fields, "acceptable_cities"), ",") {
+			if alias = strings.TrimSpace(alias); len(alias) > 0 {
+				info.Aliases = append(info.Aliases, alias)
+			}
+		}
+		if err = zips.put(info); err != nil {
+			return
+		}
+		rep.accept()
+		n++
+	}
+	return n, tx.Commit()
+}
+
+// parseZipNumbers parses coordinates and population of a zip code, empty values are zero.
+// Invalid values are left zero as well, it returns the reason then.
+func parseZipNumbers(info *ziptools.ZipInfo, cols columnMap, fields []string) (reason string) {
+	lat, latErr := strconv.ParseFloat(cols.get(fields, "latitude"), 64)
+	lon, lonErr := strconv.ParseFloat(cols.get(fields, "longitude"), 64)
+	switch {
+	case latErr == nil && lonErr == nil && lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180:
+		info.Latitude, info.Longitude = lat, lon
+	case len(cols.get(fields, "latitude")) > 0 || len(cols.get(fields, "longitude")) > 0:
+		reason = fmt.Sprintf("invalid coordinates %q %q", cols.get(fields, "latitude"), cols.get(fields, "longitude"))
+	}
+	if str := cols.get(fields, "estimated_population"); len(str) > 0 {
+		var err error
+		if info.Population, err = strconv.Atoi(str); err != nil && len(reason) == 0 {
+			reason = fmt.Sprintf("invalid population %q", str)
+		}
+	}
+	return
+}
+
+// isZip reports whether the string is a 5-digit zip code.
+func isZip(str string) bool {
+	if len(str) != ziptools.ZipLen {
+		return false
+	}
+	for _, c := range str {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// zipBuckets holds the buckets that are keyed by zip codes or index their coordinates.
+type zipBuckets struct {
+	zips         *bolt.Bucket
+	infos        *bolt.Bucket
+	cells        *bolt.Bucket
+	geohashes    *bolt.Bucket
+	zipGeohashes *bolt.Bucket
+	// precision of geohashes
+	precision int
+}
+
+func (d *builder) createZipBuckets(tx *bolt.Tx) (b *zipBuckets, err error) {
+	b = &zipBuckets{precision: d.opts.GeohashPrecision}
+	if b.zips, err = tx.CreateBucketIfNotExists(zipsBuck); err != nil {
+		return
+	}
+	if b.infos, err = tx.CreateBucketIfNotExists(zipInfoBuck); err != nil {
+		return
+	}
+	if b.cells, err = tx.CreateBucketIfNotExists(zipCellsBuck); err != nil {
+		return
+	}
+	if b.geohashes, err = tx.CreateBucketIfNotExists(geohashesBuck); err != nil {
+		return
+	}
+	if b.zipGeohashes, err = tx.CreateBucketIfNotExists(zipGeohashesBuck); err != nil {
+		return
+	}
+	return
+}
+
+// has reports whether the zip code has been put already.
+func (b *zipBuckets) has(zip ziptools.Zip) bool {
+	return b.zips.Get(zip.Bytes()) != nil
+}
+
+// get gets the zip code info if the zip code has been put already.
+func (b *zipBuckets) get(zip ziptools.Zip) (info ziptools.ZipInfo, ok bool) {
+	v := b.infos.Get(zip.Bytes())
+	if v == nil {
+		return info, false
+	}
+	return *info.FromBytes(v), true
+}
+
+// unindex removes the coordinates of the zip code from the indexes if it has been put already.
+func (b *zipBuckets) unindex(zip ziptools.Zip) (err error) {
+	prev, ok := b.get(zip)
+	if !ok || !prev.HasCoordinates() {
+		return
+	}
+	cell := ziptools.CellOf(prev.Latitude, prev.Longitude)
+	if err = b.cells.Delete(cell.Key(zip)); err != nil {
+		return
+	}
+	if hash := b.zipGeohashes.Get(zip.Bytes()); hash != nil {
+		if err = b.geohashes.Delete(append(append([]byte{}, hash...), zip[:]...)); err != nil {
+			return
+		}
+		return b.zipGeohashes.Delete(zip.Bytes())
+	}
+	return
+}
+
+// delete deletes the zip code info and its coordinates if it has been put already.
+func (b *zipBuckets) delete(zip ziptools.Zip) (err error) {
+	if err = b.unindex(zip); err != nil {
+		return
+	}
+	if err = b.zips.Delete(zip.Bytes()); err != nil {
+		return
+	}
+	return b.infos.Delete(zip.Bytes())
+}
+
+// put puts the zip code info and indexes its coordinates, replacing the previous info.
+func (b *zipBuckets) put(info ziptools.ZipInfo) (err error) {
+	zip := info.Zip
+	if err = b.unindex(zip); err != nil {
+		return
+	}
+	// zip = city
+	if err = b.zips.Put(zip.Bytes(), []byte(info.City)); err != nil {
+		return
+	}
+	// zip = info
+	if err = b.infos.Put(zip.Bytes(), info.Bytes()); err != nil {
+		return
+	}
+	if !info.HasCoordinates() {
+		return
+	}
+	// grid cell + zip
+	cell := ziptools.CellOf(info.Latitude, info.Longitude)
+	if err = b.cells.Put(cell.Key(zip), []byte{}); err != nil {
+		return
+	}
+	hash := ziptools.Geohash(info.Latitude, info.Longitude, b.precision)
+	// zip = geohash
+	if err = b.zipGeohashes.Put(zip.Bytes(), []byte(hash)); err != nil {
+		return
+	}
+	// geohash + zip
+	return b.geohashes.Put(append([]byte(hash), zip[:]...), []byte{})
+}
+
+// addSubstrings indexes zip codes by city names and by substrings of cities and zip codes.
+// The lists are collected in memory and bulk loaded in the order of keys.
+func (d *builder) addSubstrings() (err error) {
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	// create buckets
+	var cities *bolt.Bucket
+	var subcities *bolt.Bucket
+	var subzips *bolt.Bucket
+
+	if cities, err = tx.CreateBucketIfNotExists(citiesBuck); err != nil {
+		return
+	}
+	if subcities, err = tx.CreateBucketIfNotExists(subCitiesBuck); err != nil {
+		return
+	}
+	if subzips, err = tx.CreateBucketIfNotExists(subZipsBuck); err != nil {
+		return
+	}
+	infos := tx.Bucket(zipInfoBuck)
+
+	cityLists := make(zipPostings)
+	subcityLists := make(zipPostings)
+	subzipLists := make(zipPostings)
+	seen := make(map[string]struct{})
+	addCity := func(name string, zip ziptools.Zip) {
+		// full city name -> ziplist
+		cityLists.add(name, zip)
+		// subcities -> ziplist
+		// names are not unique, so filter: the first zip code named so represents
+		// a name whether it's the city or an alias, FindCities finds the names that match
+		city := strings.ToLower(name)
+		if _, ok := seen[city]; ok {
+			return
+		}
+		seen[city] = struct{}{}
+		subcityLists.addSubstrings(d.opts.Substrings, city, zip)
+	}
+
+	// the cities are collected while scanning the zip codes, every other index is a step of its own
+	d.begin(PhaseIndex, "", string(citiesBuck), nil, 0, 0)
+	if b := tx.Bucket(zipsBuck); b != nil {
+		d.progress.Total = b.Stats().KeyN
+		if err = b.ForEach(func(k []byte, v []byte) error {
+			if err := d.tick(); err != nil {
+				return err
+			}
+			zip := ziptools.NewZip(string(k))
+			addCity(string(v), zip)
+			// subzips -> ziplist
+			subzipLists.addSubstrings(d.opts.Substrings, string(k), zip)
+			if !d.opts.IndexAliases || infos == nil {
+				return nil
+			}
+			var info ziptools.ZipInfo
+			if err := info.Decode(infos.Get(k)); err != nil {
+				return err
+			}
+			for _, alias := range info.Aliases {
+				addCity(alias, zip)
+			}
+			return nil
+		}); err != nil {
+			return
+		}
+	}
+
+	if err = cityLists.put(cities, 0); err != nil {
+		return
+	}
+	d.end()
+	// lowercase name + name -> nothing, the writer finds the case variants of names
+	if err = d.indexStep(cityCasesBuck, len(cityLists), func() error {
+		return d.addCityCases(tx, cityLists)
+	}); err != nil {
+		return
+	}
+	if err = d.indexStep(subCitiesBuck, len(subcityLists), func() error {
+		return subcityLists.put(subcities, d.opts.Substrings.MaxPostings)
+	}); err != nil {
+		return
+	}
+	if err = d.indexStep(subZipsBuck, len(subzipLists), func() error {
+		return subzipLists.put(subzips, d.opts.Substrings.MaxPostings)
+	}); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// indexStep reports writing the keys of the bucket as an index phase of its own.
+func (d *builder) indexStep(bucket []byte, keys int, write func() error) error {
+	d.begin(PhaseIndex, "", string(bucket), nil, 0, keys)
+	if err := write(); err != nil {
+		return err
+	}
+	d.progress.Rows = keys
+	d.end()
+	return nil
+}
+
+// addCityCases indexes the names of the cities by their lowercase names.
+func (d *builder) addCityCases(tx *bolt.Tx, cityLists zipPostings) error {
+	cases, err := tx.CreateBucketIfNotExists(cityCasesBuck)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(cityLists))
+	for name := range cityLists {
+		keys = append(keys, string(buckets.CityCaseKey(name)))
+	}
+	return bulkPut(cases, keys, func(string) []byte {
+		return []byte{}
+	})
+}
+
+// addLocodes indexes locodes by city names, by substrings of names and by grid cells.
+// The lists are collected in memory and bulk loaded in the order of keys.
+func (d *builder) addLocodes() (err error) {
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var locodes *bolt.Bucket
+	var sublocodes *bolt.Bucket
+	var cells *bolt.Bucket
+	if locodes, err = tx.CreateBucketIfNotExists(locodesBuck); err != nil {
+		return
+	}
+	if sublocodes, err = tx.CreateBucketIfNotExists(subLocodesBuck); err != nil {
+		return
+	}
+	if cells, err = tx.CreateBucketIfNotExists(locodeCellsBuck); err != nil {
+		return
+	}
+
+	cityLists := make(locodePostings)
+	subcityLists := make(locodePostings)
+	cellLists := make(locodePostings)
+	d.begin(PhaseIndex, "", string(subLocodesBuck), nil, 0, 0)
+	if b := tx.Bucket(locationsBuck); b != nil {
+		d.progress.Total = b.Stats().KeyN
+		if err = b.ForEach(func(k []byte, v []byte) error {
+			if err := d.tick(); err != nil {
+				return err
+			}
+			var location ziptools.Location
+			if err := location.Decode(v); err != nil {
+				return err
+			}
+			locode := ziptools.NewLocode(string(k))
+			city := location.Name
+			// grid cell -> locodelist
+			if location.HasCoordinates() {
+				cell := ziptools.CellOf(location.Latitude, location.Longitude).Bytes()
+				cellLists.add(string(cell), locode)
+			}
+			// full city name -> locodelist
+			cityLists.add(city, locode)
+			// subcities -> locodelist
+			subcityLists.addSubstrings(d.opts.Substrings, strings.ToLower(city), locode)
+			return nil
+		}); err != nil {
+			return
+		}
+	}
+
+	if err = cellLists.put(cells, 0); err != nil {
+		return
+	}
+	if err = cityLists.put(locodes, 0); err != nil {
+		return
+	}
+	if err = subcityLists.put(sublocodes, d.opts.Substrings.MaxPostings); err != nil {
+		return
+	}
+	d.end()
+	return tx.Commit()
+}
+
+// addCityInfo aggregates the details of zip codes per city and state.
+func (d *builder) addCityInfo() (n int, err error) {
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var cities *bolt.Bucket
+	var infos *bolt.Bucket
+	if cities, err = tx.CreateBucketIfNotExists(cityInfoBuck); err != nil {
+		return
+	}
+	if infos, err = tx.CreateBucketIfNotExists(zipInfoBuck); err != nil {
+		return
+	}
+
+	var keys []string
+	groups := make(map[string][]ziptools.ZipInfo)
+	d.begin(PhaseIndex, "", string(cityInfoBuck), nil, 0, infos.Stats().KeyN)
+	if err = infos.ForEach(func(k, v []byte) error {
+		if err := d.tick(); err != nil {
+			return err
+		}
+		var zip ziptools.ZipInfo
+		if err := zip.Decode(v); err != nil {
+			return err
+		}
+		key := string(ziptools.CityInfo{Name: zip.City, State: zip.State}.Key())
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], zip)
+		return nil
+	}); err != nil {
+		return
+	}
+
+	// state/city = info
+	if err = bulkPut(cities, keys, func(key string) []byte {
+		return ziptools.NewCityInfo(groups[key]).Bytes()
+	}); err != nil {
+		return
+	}
+	n = len(keys)
+	d.end()
+	return n, tx.Commit()
+}
+
+// parseCoordinates parses UN/LOCODE coordinates, e.g. "4053N 07727W".
+func parseCoordinates(str string) (lat, lon float64, ok bool) {
+	parts := strings.Fields(str)
+	if len(parts) != 2 || len(parts[0]) != 5 || len(parts[1]) != 6 {
+		return 0, 0, false
+	}
+	// pos and neg are the only hemispheres of the axis
+	parse := func(s string, degLen int, pos, neg byte) (float64, bool) {
+		deg, err := strconv.Atoi(s[:degLen])
+		if err != nil {
+			return 0, false
+		}
+		min, err := strconv.Atoi(s[degLen : degLen+2])
+		if err != nil || min >= 60 {
+			return 0, false
+		}
+		v := float64(deg) + float64(min)/60
+		switch s[degLen+2] {
+		case pos:
+		case neg:
+			v = -v
+		default:
+			return 0, false
+		}
+		return v, true
+	}
+	if lat, ok = parse(parts[0], 2, 'N', 'S'); !ok || lat < -90 || lat > 90 {
+		return 0, 0, false
+	}
+	if lon, ok = parse(parts[1], 3, 'E', 'W'); !ok || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// headerIndex finds the required columns in a header, names are case insensitive.
+func headerIndex(header, required []string, source string) ([]int, error) {
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToUpper(strings.TrimSpace(name))] = i
+	}
+	idx := make([]int, len(required))
+	for i, name := range required {
+		var ok bool
+		if idx[i], ok = columns[name]; !ok {
+			return nil, fmt.Errorf("importer: %s file has no %s column", source, name)
+		}
+	}
+	return idx, nil
+}
@@ -0,0 +1,550 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/xlab/ziptools"
+)
+
+const testZips = `zip,type,decommissioned,primary_city,acceptable_cities,unacceptable_cities,state,county,timezone,area_codes,world_region,country,latitude,longitude,irs_estimated_population
+10001,STANDARD,0,New York,"Empire State",,NY,New York County,America/New_York,212,NA,US,40.75,-73.99,21000
+10002,STANDARD,0,New York,,,NY,New York County,America/New_York,212,NA,US,40.71,-73.98,
+09001,MILITARY,0,APO,,,AE,,,,EU,US,,,
+`
+
+const testLocodes = `,"US","NYC","New York","New York","NY","12345---","AI","0401",,"4042N 07400W",
+`
+
+func testDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "importer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestBuild(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(testLocodes))
+	w.Close()
+
+	dst := filepath.Join(dir, "zipcodes.db")
+	rpt, err := New(Options{
+		Zips:    []Input{{Name: "zips.csv", Reader: strings.NewReader(testZips)}},
+		Locodes: []Input{{Name: "locodes.csv.gz", Reader: &gz}},
+	}).Build(context.Background(), dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, rpt.Sources[0].Accepted)
+	assert.Equal(t, map[string]int{"military zip": 1}, rpt.Sources[0].SkipReasons)
+	assert.Equal(t, 1, rpt.Sources[1].Accepted)
+
+	db, err := ziptools.Open(dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	zips, err := db.GetZips("New York")
+	assert.NoError(t, err)
+	assert.Equal(t, ziptools.ZipList{ziptools.NewZip("10001"), ziptools.NewZip("10002")}, zips)
+	info, err := db.GetZipInfo(ziptools.NewZip("10001"))
+	assert.NoError(t, err)
+	assert.Equal(t, 21000, info.Population)
+	assert.Equal(t, []string{"Empire State"}, info.Aliases)
+	location, err := db.GetLocation(ziptools.NewLocode("NYC"))
+	assert.NoError(t, err)
+	assert.Equal(t, "New York", location.Name)
+}
+
+func TestBuildMetadata(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	policy := ziptools.SubstringPolicy{MinLength: 2}
+	_, err := New(Options{
+		Zips:         []Input{{Name: "zips.csv", Reader: strings.NewReader(testZips)}},
+		Locodes:      []Input{{Name: "locodes.csv", Reader: strings.NewReader(testLocodes)}},
+		IndexAliases: true,
+		Substrings:   policy,
+	}).Build(context.Background(), dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	db, err := ziptools.Open(dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	meta, err := db.Metadata()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, ziptools.SchemaVersion, meta.SchemaVersion)
+	assert.WithinDuration(t, time.Now(), meta.Built, time.Minute)
+	sum := sha256.Sum256([]byte(testZips))
+	assert.Equal(t, []ziptools.Source{
+		{Kind: "zips", Name: "zips.csv", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(testZips))},
+	}, meta.Sources[:1])
+	assert.Equal(t, "locodes", meta.Sources[1].Kind)
+	assert.Equal(t, 2, meta.Counts["zipinfo"])
+	assert.Equal(t, 1, meta.Counts["locations"])
+	assert.Equal(t, ziptools.IndexOptions{
+		Substrings:       policy,
+		Aliases:          true,
+		GeohashPrecision: DefaultGeohashPrecision,
+	}, meta.Index)
+}
+
+func TestBuildAliases(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	// the alias of 00603 comes first and collides with the city of 16671
+	zips := `zip,type,decommissioned,primary_city,acceptable_cities,unacceptable_cities,state,county,timezone,area_codes,world_region,country,latitude,longitude,irs_estimated_population
+00603,STANDARD,0,Aguadilla,Ramey,,PR,Aguadilla Municipio,America/Puerto_Rico,787,NA,US,18.43,-67.15,
+16671,STANDARD,0,Ramey,,,PA,Clearfield County,America/New_York,814,NA,US,40.8,-78.4,
+`
+	_, err := New(Options{
+		Zips:         []Input{{Name: "zips.csv", Reader: strings.NewReader(zips)}},
+		IndexAliases: true,
+	}).Build(context.Background(), dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	db, err := ziptools.Open(dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	cities, err := db.FindCities("ramey")
+	assert.NoError(t, err)
+	assert.Equal(t, ziptools.CityList{"Ramey"}, cities)
+	cities, err = db.FindCities("aguad")
+	assert.NoError(t, err)
+	assert.Equal(t, ziptools.CityList{"Aguadilla"}, cities)
+	list, err := db.GetZips("Ramey")
+	assert.NoError(t, err)
+	assert.Equal(t, ziptools.ZipList{ziptools.NewZip("00603"), ziptools.NewZip("16671")}, list)
+	info, err := db.GetCityInfo("Ramey", "PA")
+	assert.NoError(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, ziptools.ZipList{ziptools.NewZip("16671")}, info.Zips)
+	}
+
+	// the city stays found when the zip code of the alias is gone
+	assert.NoError(t, db.DeleteZip(ziptools.NewZip("00603")))
+	cities, err = db.FindCities("ramey")
+	assert.NoError(t, err)
+	assert.Equal(t, ziptools.CityList{"Ramey"}, cities)
+	cities, err = db.FindCities("aguad")
+	assert.NoError(t, err)
+	assert.Empty(t, cities)
+}
+
+func TestBuildCountyShares(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	hud := `ZIP,COUNTY,RES_RATIO,BUS_RATIO,OTH_RATIO,TOT_RATIO
+10001,36061,0.9,0.8,1,0.88
+10001,36047,0.1,0.2,0,0.12
+`
+	_, err := New(Options{
+		Zips:      []Input{{Name: "zips.csv", Reader: strings.NewReader(testZips)}},
+		HUDCounty: []Input{{Name: "hud.csv", Reader: strings.NewReader(hud)}},
+	}).Build(context.Background(), dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	db, err := ziptools.Open(dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	shares, err := db.GetCountyShares(ziptools.NewZip("10001"))
+	assert.NoError(t, err)
+	if assert.Len(t, shares, 2) {
+		assert.Equal(t, "36061", shares[0].County)
+	}
+	// the crosswalk doesn't cover the zip code
+	shares, err = db.GetCountyShares(ziptools.NewZip("10002"))
+	assert.NoError(t, err)
+	assert.Empty(t, shares)
+}
+
+// cspRecord lays out a City State Product record with the values of the fields.
+func cspRecord(values map[cspField]string) string {
+	rec := []byte(strings.Repeat(" ", cspRecordLen))
+	for f, v := range values {
+		copy(rec[f.from-1:f.to], v)
+	}
+	return string(rec) + "\n"
+}
+
+func TestBuildUSPS(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	detail := func(zip, class, city, mailing, preferred string) string {
+		return cspRecord(map[cspField]string{
+			cspCopyrightCode: "D", cspZip: zip, cspClassification: class, cspCityName: city,
+			cspMailingIndicator: mailing, cspPreferredCityName: preferred, cspState: "NY", cspCountyName: "ONONDAGA",
+		})
+	}
+	csp := cspRecord(map[cspField]string{
+		cspCopyrightCode: "A", cspZip: "13252", cspAliasStreetName: "CARRIER", cspAliasStreetSuffix: "CIR",
+	}) + detail("13252", "P", "SYRACUSE", "Y", "SYRACUSE") +
+		detail("13252", "P", "SALINA", "Y", "SYRACUSE") +
+		detail("13252", "P", "DEWITT", "N", "SYRACUSE") +
+		detail("09001", "M", "APO", "Y", "APO") +
+		cspRecord(map[cspField]string{cspCopyrightCode: "A", cspZip: "09001", cspAliasStreetName: "UNIT"}) +
+		cspRecord(map[cspField]string{cspCopyrightCode: "S", cspZip: "13261"})
+	rpt, err := New(Options{
+		USPS: []Input{{Name: "csp.txt", Reader: strings.NewReader(csp)}},
+	}).Build(context.Background(), dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, rpt.Sources[0].Accepted)
+	assert.Equal(t, map[string]int{"military zip": 1}, rpt.Sources[0].SkipReasons)
+
+	db, err := ziptools.Open(dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	info, err := db.GetZipInfo(ziptools.NewZip("13252"))
+	assert.NoError(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, "Syracuse", info.City)
+		assert.Equal(t, "PO BOX", info.Type)
+		assert.Equal(t, []string{"Carrier Cir", "Salina"}, info.Aliases)
+	}
+	city, err := db.GetCity(ziptools.NewZip("09001"))
+	assert.NoError(t, err)
+	assert.Empty(t, city)
+}
+
+func TestBuildPostalCodes(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	codes := `CA,K1A 0B1,Ottawa,ON
+CAN,K1A 0B2,Ottawa,ON
+US,10001,New York,NY
+`
+	rpt, err := New(Options{
+		PostalCodes: []Input{{Name: "postal.csv", Reader: strings.NewReader(codes)}},
+	}).Build(context.Background(), dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, rpt.Sources[0].Accepted)
+	assert.Equal(t, 1, rpt.Sources[0].Malformed)
+	assert.Equal(t, map[string]int{"US postal code": 1}, rpt.Sources[0].SkipReasons)
+
+	db, err := ziptools.Open(dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	list, err := db.GetPostalCodes("CA", "Ottawa")
+	assert.NoError(t, err)
+	assert.Equal(t, ziptools.PostalCodeList{ziptools.NewPostalCode("CA", "K1A0B1")}, list)
+}
+
+func TestBuildStrict(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	zips := testZips + "1000x,STANDARD,0,New York,,,NY,,,,,,,,\n"
+	rpt, err := New(Options{
+		Zips:   []Input{{Name: "zips.csv", Reader: strings.NewReader(zips)}},
+		Strict: true,
+	}).Build(context.Background(), dst)
+	if perr, ok := err.(*ProblemError); assert.True(t, ok) {
+		assert.Equal(t, ProblemMalformed, perr.Kind)
+		assert.Equal(t, 5, perr.Line)
+	}
+	assert.Equal(t, 1, rpt.Sources[0].Malformed)
+	_, err = os.Stat(dst)
+	assert.True(t, os.IsNotExist(err))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func TestBuildTruncated(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	truncated := func(data string) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(data))
+		w.Close()
+		return buf.Bytes()[:buf.Len()/2]
+	}
+	zips := testZips
+	var geonames string
+	for i := 10000; i < 12000; i++ {
+		zips += fmt.Sprintf("%d,STANDARD,0,New York,,,NY,,,,,,,,%d\n", i, i*7)
+		geonames += fmt.Sprintf("US\t%d\tNew York\tNew York\tNY\t\t\t\t\t40.75\t-73.99\t4\n", i)
+	}
+	// reading truncated files fails on every row, in the lenient mode too
+	for _, opts := range []Options{
+		{Zips: []Input{{Name: "zips.csv.gz", Reader: bytes.NewReader(truncated(zips))}}},
+		{GeoNames: []Input{{Name: "US.txt.gz", Reader: bytes.NewReader(truncated(geonames))}}},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := New(opts).Build(ctx, dst)
+		cancel()
+		if assert.Error(t, err) {
+			assert.NotEqual(t, context.DeadlineExceeded, err)
+			assert.Contains(t, err.Error(), ".gz")
+		}
+	}
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func TestBuildColumns(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	_, err := New(Options{
+		Zips:       []Input{{Name: "zips.csv", Reader: strings.NewReader("Code,Kind,Town,St\n10001,STANDARD,New York,NY\n")}},
+		ZipColumns: map[string]string{"zip": "Code", "type": "Kind", "primary_city": "Town", "state": "4"},
+	}).Build(context.Background(), dst)
+	assert.NoError(t, err)
+
+	_, err = New(Options{
+		Zips: []Input{{Name: "zips.csv", Reader: strings.NewReader("a,b,c\n1,2,3\n")}},
+	}).Build(context.Background(), dst)
+	assert.Error(t, err)
+	_, err = New(Options{ZipColumns: map[string]string{"bogus": "1"}}).Build(context.Background(), dst)
+	assert.Error(t, err)
+}
+
+func TestBuildProgress(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	var phases []Progress
+	_, err := New(Options{
+		Zips: []Input{{Name: "zips.csv", Reader: strings.NewReader(testZips), Size: int64(len(testZips))}},
+		Progress: func(p Progress) {
+			if p.Done {
+				phases = append(phases, p)
+			}
+		},
+	}).Build(context.Background(), filepath.Join(dir, "zipcodes.db"))
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, phases) {
+		assert.Equal(t, Progress{Phase: "zips", Input: "zips.csv", Bucket: "zipinfo", Rows: 3, Total: 3, Done: true}, phases[0])
+		var buckets []string
+		for _, p := range phases[1:] {
+			buckets = append(buckets, p.Bucket)
+		}
+		assert.Equal(t, []string{"sublocodes", "cities", "citycases", "subcities", "subzips", "subpostalcodes", "cityinfo"}, buckets)
+		assert.Equal(t, Progress{Phase: PhaseIndex, Bucket: "cities", Rows: 2, Total: 2, Done: true}, phases[2])
+		assert.Equal(t, Progress{Phase: PhaseIndex, Bucket: "subzips", Rows: 13, Total: 13, Done: true}, phases[5])
+	}
+}
+
+func TestBuildCancel(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dst := filepath.Join(dir, "zipcodes.db")
+	_, err := New(Options{
+		Zips: []Input{{Name: "zips.csv", Reader: strings.NewReader(testZips)}},
+	}).Build(ctx, dst)
+	assert.Equal(t, context.Canceled, err)
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+// endlessReader repeats a row forever.
+type endlessReader struct {
+	row []byte
+	off int
+}
+
+func (r *endlessReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		c := copy(p[n:], r.row[r.off:])
+		n += c
+		r.off = (r.off + c) % len(r.row)
+	}
+	return
+}
+
+func TestBuildCancelMalformed(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	header := testZips[:strings.IndexByte(testZips, '\n')+1]
+	// rows that can't be read are checked for cancellation like the others
+	rows := io.MultiReader(strings.NewReader(header), &endlessReader{row: []byte("10001,STANDARD,\"New\"York,NY\n")})
+	_, err := New(Options{
+		Zips: []Input{{Name: "zips.csv", Reader: rows}},
+		Progress: func(p Progress) {
+			if p.Rows >= 5000 {
+				cancel()
+			}
+		},
+	}).Build(ctx, filepath.Join(dir, "zipcodes.db"))
+	assert.Equal(t, context.Canceled, err)
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func TestBuildSubstrings(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	policy := ziptools.SubstringPolicy{MinLength: 2, MaxLength: 4, PrefixOnly: true, MaxPostings: 1}
+	_, err := New(Options{
+		Zips:       []Input{{Name: "zips.csv", Reader: strings.NewReader(testZips)}},
+		Substrings: policy,
+	}).Build(context.Background(), dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = New(Options{Substrings: ziptools.SubstringPolicy{MinLength: 2, MaxLength: 1}}).Build(context.Background(), dst)
+	assert.Error(t, err)
+
+	db, err := ziptools.Open(dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	assert.Equal(t, policy, db.SubstringPolicy())
+	zips, err := db.FindZips("1000")
+	assert.NoError(t, err)
+	assert.Equal(t, ziptools.ZipList{ziptools.NewZip("10001")}, zips)
+	zips, err = db.FindZips("0001")
+	assert.NoError(t, err)
+	assert.Empty(t, zips)
+	_, err = db.FindZips("1")
+	assert.IsType(t, &ziptools.QueryError{}, err)
+	_, err = db.FindZips("10001")
+	assert.IsType(t, &ziptools.QueryError{}, err)
+	cities, err := db.FindCities("New")
+	assert.NoError(t, err)
+	assert.Equal(t, ziptools.CityList{"New York"}, cities)
+}
+
+func TestBuildBoundaries(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	square := func(lat, lon float64) string {
+		return fmt.Sprintf(`{"type":"Feature","properties":{"ZCTA5CE20":"10001"},"geometry":{"type":"Polygon","coordinates":[[[%[2]g,%[1]g],[%[2]g,%.2[3]f],[%.2[4]f,%.2[3]f],[%.2[4]f,%[1]g],[%[2]g,%[1]g]]]}}`,
+			lat, lon, lat+0.1, lon+0.1)
+	}
+	// the later boundary of a zip code replaces the earlier one along with its grid cells
+	zcta := `{"type":"FeatureCollection","features":[` + square(10, 10) + "," + square(40.7, -74) + `]}`
+	_, err := New(Options{
+		Zips: []Input{{Name: "zips.csv", Reader: strings.NewReader(testZips)}},
+		ZCTA: []Input{{Name: "zcta.geojson", Reader: strings.NewReader(zcta)}},
+	}).Build(context.Background(), dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	bdb, err := bolt.Open(dst, 0644, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, bdb.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket(boundaryCellsBuck).Get(ziptools.CellOf(10.05, 10.05).Key(ziptools.NewZip("10001"))))
+		assert.NotNil(t, tx.Bucket(boundaryCellsBuck).Get(ziptools.CellOf(40.75, -73.95).Key(ziptools.NewZip("10001"))))
+		return nil
+	}))
+	assert.NoError(t, bdb.Close())
+
+	db, err := ziptools.Open(dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	zip, exact, err := db.ZipAt(40.75, -73.95)
+	assert.NoError(t, err)
+	assert.True(t, exact)
+	assert.Equal(t, ziptools.NewZip("10001"), zip)
+}
+
+func TestBuildFilter(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "zipcodes.db")
+	zips := testZips + `10003,STANDARD,0,New York,,,NY,,,,,,41.5,-73.99,
+07001,PO BOX,0,Avenel,,,NJ,,,,,,40.58,-74.27,
+`
+	locodes := testLocodes + `,"US","BKN","Brooklyn","Brooklyn","NY","1-------","AI","0401",,"4040N 07356W",
+`
+	rpt, err := New(Options{
+		Zips:    []Input{{Name: "zips.csv", Reader: strings.NewReader(zips)}},
+		Locodes: []Input{{Name: "locodes.csv", Reader: strings.NewReader(locodes)}},
+		Filter: Filter{
+			States:      []string{"ny", "NJ"},
+			ZipPrefixes: []string{"100", "07"},
+			ZipTypes:    []string{"STANDARD"},
+			BBox:        &ziptools.BBox{Min: ziptools.Point{Lat: 40.5, Lon: -74.5}, Max: ziptools.Point{Lat: 41, Lon: -73.5}},
+			Functions:   ziptools.FunctionAirport,
+		},
+	}).Build(context.Background(), dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, rpt.Sources[0].Accepted)
+	assert.Equal(t, map[string]int{"military zip": 1, "filtered by bbox": 1, "filtered by zip type": 1}, rpt.Sources[0].SkipReasons)
+	assert.Equal(t, 1, rpt.Sources[1].Accepted)
+	assert.Equal(t, map[string]int{"filtered by function": 1}, rpt.Sources[1].SkipReasons)
+
+	db, err := ziptools.Open(dst)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	zipList, err := db.GetZips("New York")
+	assert.NoError(t, err)
+	assert.Equal(t, ziptools.ZipList{ziptools.NewZip("10001"), ziptools.NewZip("10002")}, zipList)
+	locodeList, err := db.FindLocodes("b")
+	assert.NoError(t, err)
+	assert.Empty(t, locodeList)
+}
+
+func TestParseCoordinates(t *testing.T) {
+	lat, lon, ok := parseCoordinates("4042N 07400W")
+	assert.True(t, ok)
+	assert.InDelta(t, 40.7, lat, 0.001)
+	assert.InDelta(t, -74, lon, 0.001)
+	lat, lon, ok = parseCoordinates("3352S 15112E")
+	assert.True(t, ok)
+	assert.InDelta(t, -33.867, lat, 0.001)
+	assert.InDelta(t, 151.2, lon, 0.001)
+	for _, str := range []string{"4042E 07400W", "4042N 07400N", "4042X 07400W", "4042N 07400 ", "4060N 07400W"} {
+		_, _, ok = parseCoordinates(str)
+		assert.False(t, ok, str)
+	}
+}
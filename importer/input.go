@@ -0,0 +1,40 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Magic bytes of compressed inputs.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompress calls fn with the decompressed input, the format is detected by magic bytes.
+func decompress(name string, r io.Reader, fn func(r io.Reader) error) error {
+	in := bufio.NewReader(r)
+	magic, _ := in.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		r, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("importer: malformed gzip input %s: %v", name, err)
+		}
+		defer r.Close()
+		return fn(r)
+	case bytes.HasPrefix(magic, zstdMagic):
+		r, err := zstd.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("importer: malformed zstd input %s: %v", name, err)
+		}
+		defer r.Close()
+		return fn(r)
+	}
+	return fn(in)
+}
@@ -0,0 +1,158 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools"
+)
+
+// addPostalCodes reads international postal codes from a CSV with the columns:
+// country, postal code, city, state, county, latitude, longitude; the last three are optional.
+// US codes are skipped, zip codes are imported separately.
+func (d *builder) addPostalCodes(csv *csv.Reader, rep *SourceReport) (n int, err error) {
+	csv.FieldsPerRecord = -1
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var codes *bolt.Bucket
+	if codes, err = tx.CreateBucketIfNotExists(postalCodesBuck); err != nil {
+		return
+	}
+	seen := make(map[string]struct{})
+	for {
+		var fields []string
+		fields, err = csv.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// rows that can't be read count as well, so cancellation is checked on every row
+			if err = rep.readError(err); err == nil {
+				err = d.tick()
+			}
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if err = d.tick(); err != nil {
+			return
+		}
+		line := lineOf(csv)
+		if len(fields) < 4 {
+			if err = rep.malformed(line, "too few columns"); err != nil {
+				return
+			}
+			continue
+		}
+		info := ziptools.PostalCodeInfo{
+			PostalCode: ziptools.NewPostalCode(fields[0], fields[1]),
+			City:       fields[2],
+			State:      fields[3],
+		}
+		if len(info.PostalCode.Country) == 0 {
+			if err = rep.malformed(line, fmt.Sprintf("invalid country %q", fields[0])); err != nil {
+				return
+			}
+			continue
+		}
+		if info.PostalCode.IsZip() {
+			rep.skip("US postal code")
+			continue
+		}
+		if len(info.PostalCode.Code) == 0 {
+			if err = rep.malformed(line, "empty postal code"); err != nil {
+				return
+			}
+			continue
+		}
+		if len(fields) > 6 {
+			info.County = fields[4]
+			info.Latitude, _ = strconv.ParseFloat(fields[5], 64)
+			info.Longitude, _ = strconv.ParseFloat(fields[6], 64)
+		}
+		if reason := d.opts.Filter.postalCode(info); len(reason) > 0 {
+			rep.skip(reason)
+			continue
+		}
+		key := string(info.PostalCode.Key())
+		if _, ok := seen[key]; ok {
+			if err = rep.duplicate(line, "postal code "+info.PostalCode.String()); err != nil {
+				return
+			}
+		}
+		seen[key] = struct{}{}
+		if err = d.putPostalCode(codes, info); err != nil {
+			return
+		}
+		rep.accept()
+		n++
+	}
+	return n, tx.Commit()
+}
+
+// putPostalCode puts a postal code info into the bucket.
+func (d *builder) putPostalCode(codes *bolt.Bucket, info ziptools.PostalCodeInfo) error {
+	// country + code = info
+	return codes.Put(info.PostalCode.Key(), info.Bytes())
+}
+
+// addPostalSubstrings indexes postal codes by city and by substrings of codes.
+// The lists are collected in memory and bulk loaded in the order of keys.
+func (d *builder) addPostalSubstrings() (err error) {
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var codes *bolt.Bucket
+	var cities *bolt.Bucket
+	var subcodes *bolt.Bucket
+	if codes, err = tx.CreateBucketIfNotExists(postalCodesBuck); err != nil {
+		return
+	}
+	if cities, err = tx.CreateBucketIfNotExists(postalCitiesBuck); err != nil {
+		return
+	}
+	if subcodes, err = tx.CreateBucketIfNotExists(subPostalCodesBuck); err != nil {
+		return
+	}
+	cityLists := make(postalPostings)
+	subcodeLists := make(postalPostings)
+	d.begin(PhaseIndex, "", string(subPostalCodesBuck), nil, 0, codes.Stats().KeyN)
+	if err = codes.ForEach(func(k, v []byte) error {
+		if err := d.tick(); err != nil {
+			return err
+		}
+		var info ziptools.PostalCodeInfo
+		if err := info.Decode(v); err != nil {
+			return err
+		}
+		code := info.PostalCode
+		// country + full city name -> postal code list
+		cityLists.add(code.Country+info.City, code)
+		// country + subcodes -> postal code list
+		d.opts.Substrings.Substrings(code.Code, func(substr string) {
+			subcodeLists.add(code.Country+substr, code)
+		})
+		return nil
+	}); err != nil {
+		return
+	}
+	if err = cityLists.put(cities, 0); err != nil {
+		return
+	}
+	if err = subcodeLists.put(subcodes, d.opts.Substrings.MaxPostings); err != nil {
+		return
+	}
+	d.end()
+	return tx.Commit()
+}
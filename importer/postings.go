@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools"
+)
+
+// bulkFillPercent fills the pages of buckets that are loaded in the order of keys,
+// bolt splits pages at a half by default which leaves them half empty on sequential writes.
+const bulkFillPercent = 1.0
+
+// bulkPut puts the values into the bucket in the order of keys.
+func bulkPut(buck *bolt.Bucket, keys []string, value func(key string) []byte) error {
+	sort.Strings(keys)
+	buck.FillPercent = bulkFillPercent
+	for _, key := range keys {
+		if err := buck.Put([]byte(key), value(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postingList is a list of entries collected by postings, e.g. ziptools.ZipList.
+type postingList[T any] interface {
+	~[]T
+	Bytes() []byte
+}
+
+// postings collects lists of entries by keys in memory.
+type postings[T any, L postingList[T]] map[string]L
+
+// zipPostings, locodePostings and postalPostings collect the lists of the buckets.
+type (
+	zipPostings    = postings[ziptools.Zip, ziptools.ZipList]
+	locodePostings = postings[ziptools.Locode, ziptools.LocodeList]
+	postalPostings = postings[ziptools.PostalCode, ziptools.PostalCodeList]
+)
+
+func (p postings[T, L]) add(key string, entry T) {
+	p[key] = append(p[key], entry)
+}
+
+// addSubstrings adds the entry to the substrings of str indexed by the policy.
+func (p postings[T, L]) addSubstrings(policy ziptools.SubstringPolicy, str string, entry T) {
+	policy.Substrings(str, func(substr string) {
+		p.add(substr, entry)
+	})
+}
+
+// put bulk loads the lists into the bucket, lists are truncated to max entries unless it's zero.
+func (p postings[T, L]) put(buck *bolt.Bucket, max int) error {
+	keys := make([]string, 0, len(p))
+	for key := range p {
+		keys = append(keys, key)
+	}
+	return bulkPut(buck, keys, func(key string) []byte {
+		list := p[key]
+		if max > 0 && len(list) > max {
+			list = list[:max]
+		}
+		return list.Bytes()
+	})
+}
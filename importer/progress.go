@@ -0,0 +1,80 @@
+package importer
+
+import "io"
+
+// progressEvery is the number of rows between progress reports.
+const progressEvery = 1000
+
+// PhaseIndex is the phase of building indexes, other phases are named after the kind of inputs,
+// e.g. "zips" or "locodes".
+const PhaseIndex = "index"
+
+// Progress describes the progress of a build.
+type Progress struct {
+	// Phase is the kind of inputs being imported, e.g. "zips", or PhaseIndex.
+	Phase string
+	// Input is the name of the input being imported, empty while indexing.
+	Input string
+	// Bucket is the bucket being written.
+	Bucket string
+	// Rows is the number of rows processed in the phase.
+	Rows int
+	// Total is an estimate of rows in the phase, zero if unknown. Inputs are
+	// estimated by the bytes read unless their size is unknown.
+	Total int
+	// Done reports whether the phase is complete.
+	Done bool
+}
+
+// countingReader counts bytes read.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	r.n += int64(n)
+	return
+}
+
+// begin starts a phase, the input is counted to estimate the total of rows.
+func (d *builder) begin(phase, input, bucket string, in *countingReader, size int64, total int) {
+	d.progress = Progress{Phase: phase, Input: input, Bucket: bucket, Total: total}
+	d.input, d.size = in, size
+	d.notify()
+}
+
+// tick counts a row and checks for cancellation, it reports progress every progressEvery rows.
+func (d *builder) tick() error {
+	if err := d.ctx.Err(); err != nil {
+		return err
+	}
+	d.progress.Rows++
+	if d.progress.Rows%progressEvery == 0 {
+		d.notify()
+	}
+	return nil
+}
+
+// end completes a phase.
+func (d *builder) end() {
+	d.progress.Done = true
+	d.progress.Total = d.progress.Rows
+	d.notify()
+	d.input, d.size = nil, 0
+}
+
+func (d *builder) notify() {
+	if d.opts.Progress == nil {
+		return
+	}
+	p := d.progress
+	if !p.Done && d.input != nil && d.input.n > 0 && d.size > 0 {
+		p.Total = int(float64(p.Rows) * float64(d.size) / float64(d.input.n))
+	}
+	if p.Total < p.Rows {
+		p.Total = p.Rows
+	}
+	d.opts.Progress(p)
+}
@@ -0,0 +1,148 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxProblems limits the problems listed per source, the rest are only counted.
+const maxProblems = 1000
+
+// Kinds of problems.
+const (
+	ProblemMalformed = "malformed"
+	ProblemDuplicate = "duplicate"
+	ProblemInvalid   = "invalid"
+)
+
+// Report is the outcome of a build. It counts rows of zips, locodes and postal codes per input.
+type Report struct {
+	Strict  bool            `json:"strict"`
+	Sources []*SourceReport `json:"sources"`
+}
+
+// SourceReport counts rows of an input file. Skipped rows are left out by design, e.g. military zips.
+// Problems of the data are listed along with their line numbers: malformed rows are left out, rows
+// with an invalid value are accepted without the value, duplicates replace the rows seen before.
+type SourceReport struct {
+	Source      string         `json:"source"`
+	Name        string         `json:"name"`
+	Accepted    int            `json:"accepted"`
+	Skipped     int            `json:"skipped"`
+	SkipReasons map[string]int `json:"skip_reasons,omitempty"`
+	Malformed   int            `json:"malformed"`
+	Invalid     int            `json:"invalid"`
+	Duplicates  int            `json:"duplicates"`
+	Problems    []Problem      `json:"problems,omitempty"`
+	// Omitted counts problems that are not listed due to maxProblems.
+	Omitted int `json:"omitted,omitempty"`
+
+	strict bool
+}
+
+// Problem is a malformed, invalid or duplicate row.
+type Problem struct {
+	Line   int    `json:"line"`
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+}
+
+// ProblemError aborts a strict build.
+type ProblemError struct {
+	Source string
+	Name   string
+	Problem
+}
+
+func (e *ProblemError) Error() string {
+	return fmt.Sprintf("importer: %s: %s line %d in %s: %s", e.Source, e.Kind, e.Line, e.Name, e.Reason)
+}
+
+// add starts a report of the input file.
+func (r *Report) add(source, name string) *SourceReport {
+	s := &SourceReport{
+		Source:      source,
+		Name:        name,
+		SkipReasons: make(map[string]int),
+		strict:      r.Strict,
+	}
+	r.Sources = append(r.Sources, s)
+	return s
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (s *SourceReport) accept() {
+	s.Accepted++
+}
+
+func (s *SourceReport) skip(reason string) {
+	s.Skipped++
+	s.SkipReasons[reason]++
+}
+
+// malformed records a malformed row, it returns an error in the strict mode.
+func (s *SourceReport) malformed(line int, reason string) error {
+	s.Malformed++
+	return s.problem(line, ProblemMalformed, reason)
+}
+
+// invalid records an invalid value of an accepted row, it returns an error in the strict mode.
+func (s *SourceReport) invalid(line int, reason string) error {
+	s.Invalid++
+	return s.problem(line, ProblemInvalid, reason)
+}
+
+// duplicate records a duplicate row, it returns an error in the strict mode.
+func (s *SourceReport) duplicate(line int, key string) error {
+	s.Duplicates++
+	return s.problem(line, ProblemDuplicate, fmt.Sprintf("%s seen already", key))
+}
+
+func (s *SourceReport) problem(line int, kind, reason string) error {
+	p := Problem{Line: line, Kind: kind, Reason: reason}
+	if len(s.Problems) < maxProblems {
+		s.Problems = append(s.Problems, p)
+	} else {
+		s.Omitted++
+	}
+	if s.strict {
+		return &ProblemError{Source: s.Source, Name: s.Name, Problem: p}
+	}
+	return nil
+}
+
+// readError records a row that can't be parsed, it returns an error in the strict mode.
+// Other errors of reading end the import, see readFailed.
+func (s *SourceReport) readError(err error) error {
+	if err := readFailed(s.Name, err); err != nil {
+		return err
+	}
+	perr := err.(*csv.ParseError)
+	return s.malformed(perr.Line, perr.Err.Error())
+}
+
+// readFailed returns the error that ends the import of the file unless reading a row failed due to the row
+// being malformed. Readers return other errors, e.g. of truncated compressed files, again on every read.
+func readFailed(name string, err error) error {
+	if _, ok := err.(*csv.ParseError); ok {
+		return nil
+	}
+	return fmt.Errorf("importer: reading %s: %v", name, err)
+}
+
+// lineOf returns the line of the last row read.
+func lineOf(in *csv.Reader) int {
+	line, _ := in.FieldPos(0)
+	return line
+}
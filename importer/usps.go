@@ -0,0 +1,215 @@
+package importer
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/xlab/ziptools"
+)
+
+// cspRecordLen is the length of a USPS City State Product record.
+const cspRecordLen = 129
+
+// cspField is a fixed-width field of a City State Product record, positions are 1-based as in the USPS layout.
+type cspField struct{ from, to int }
+
+// City State Product detail record layout, the copyright code tells the record type.
+var (
+	cspCopyrightCode     = cspField{1, 1}
+	cspZip               = cspField{2, 6}
+	cspClassification    = cspField{13, 13}
+	cspCityName          = cspField{14, 41}
+	cspMailingIndicator  = cspField{56, 56}
+	cspPreferredCityName = cspField{63, 90}
+	cspState             = cspField{100, 101}
+	cspCountyName        = cspField{105, 129}
+)
+
+// City State Product alias record layout.
+var (
+	cspAliasPreDirectional  = cspField{7, 8}
+	cspAliasStreetName      = cspField{9, 36}
+	cspAliasStreetSuffix    = cspField{37, 40}
+	cspAliasPostDirectional = cspField{41, 42}
+)
+
+// City State Product record types.
+const (
+	cspDetail = "D"
+	cspAlias  = "A"
+)
+
+func (f cspField) get(rec []byte) string {
+	return strings.TrimSpace(string(rec[f.from-1 : f.to]))
+}
+
+// cspZipTypes maps ZIP classification codes to the zip types of the CSV database.
+var cspZipTypes = map[string]string{
+	"":  "STANDARD",
+	"M": "MILITARY",
+	"P": "PO BOX",
+	"U": "UNIQUE",
+}
+
+// addCityStateProduct reads USPS City State Product records. A zip code has a detail record
+// per city name: the preferred last line name becomes the city of the zip, other names that are
+// acceptable for mailing become its aliases, as well as the alias names of alias records.
+// Other record types are skipped, as well as military zips like the CSV import does.
+// Zip codes imported already keep their coordinates and population.
+func (d *builder) addCityStateProduct(r io.Reader, rep *SourceReport) (n int, err error) {
+	type entry struct {
+		info    ziptools.ZipInfo
+		aliases map[string]struct{}
+		// detailed tells whether a detail record of the zip has been read, alias records may come first
+		detailed bool
+	}
+	var order []ziptools.Zip
+	entries := make(map[ziptools.Zip]*entry)
+	military := make(map[ziptools.Zip]struct{})
+	addAlias := func(e *entry, alias string) {
+		if _, ok := e.aliases[alias]; !ok && len(alias) > 0 {
+			e.aliases[alias] = struct{}{}
+			e.info.Aliases = append(e.info.Aliases, alias)
+		}
+	}
+
+	in := bufio.NewReader(r)
+	rec := make([]byte, cspRecordLen)
+	for {
+		if err = readRecord(in, rec); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err == io.ErrUnexpectedEOF {
+				d.logln("importer: ignored a truncated USPS record at the end of file")
+				break
+			}
+			return
+		}
+		if err = d.tick(); err != nil {
+			return
+		}
+		kind := cspCopyrightCode.get(rec)
+		if kind != cspDetail && kind != cspAlias {
+			continue
+		}
+		zip := ziptools.NewZip(cspZip.get(rec))
+		if _, ok := military[zip]; ok {
+			continue
+		}
+		e, ok := entries[zip]
+		if !ok {
+			e = &entry{info: ziptools.ZipInfo{Zip: zip}, aliases: make(map[string]struct{})}
+			entries[zip] = e
+			order = append(order, zip)
+		}
+		if kind == cspAlias {
+			var parts []string
+			for _, f := range []cspField{cspAliasPreDirectional, cspAliasStreetName, cspAliasStreetSuffix, cspAliasPostDirectional} {
+				if part := f.get(rec); len(part) > 0 {
+					parts = append(parts, part)
+				}
+			}
+			addAlias(e, titleCase(strings.Join(parts, " ")))
+			continue
+		}
+		if !e.detailed {
+			zipType := cspZipTypes[cspClassification.get(rec)]
+			if zipType == "MILITARY" {
+				rep.skip("military zip")
+				military[zip] = struct{}{}
+				delete(entries, zip)
+				continue
+			}
+			e.detailed = true
+			e.info.Type = zipType
+			e.info.City = titleCase(cspPreferredCityName.get(rec))
+			e.info.State = cspState.get(rec)
+			e.info.County = titleCase(cspCountyName.get(rec))
+		}
+		if city := titleCase(cspCityName.get(rec)); cspMailingIndicator.get(rec) == "Y" && city != e.info.City {
+			addAlias(e, city)
+		}
+	}
+
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var zips *zipBuckets
+	if zips, err = d.createZipBuckets(tx); err != nil {
+		return
+	}
+	for _, zip := range order {
+		e, ok := entries[zip]
+		if !ok || !e.detailed {
+			continue
+		}
+		info := e.info
+		// alias records read before the detail records may name the city
+		info.Aliases = removeString(info.Aliases, info.City)
+		if prev, ok := zips.get(zip); ok {
+			info.Latitude, info.Longitude = prev.Latitude, prev.Longitude
+			info.Timezone, info.Population = prev.Timezone, prev.Population
+			if len(prev.County) > 0 {
+				info.County = prev.County
+			}
+		}
+		if reason := d.opts.Filter.zip(info); len(reason) > 0 {
+			rep.skip(reason)
+			if err = zips.delete(zip); err != nil {
+				return
+			}
+			continue
+		}
+		if err = zips.put(info); err != nil {
+			return
+		}
+		rep.accept()
+		n++
+	}
+	return n, tx.Commit()
+}
+
+// readRecord reads a fixed-length record, records may be delimited by line breaks.
+func readRecord(in *bufio.Reader, rec []byte) error {
+	for {
+		c, err := in.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c != '\r' && c != '\n' {
+			in.UnreadByte()
+			break
+		}
+	}
+	_, err := io.ReadFull(in, rec)
+	return err
+}
+
+// removeString removes every occurrence of str from the list.
+func removeString(list []string, str string) []string {
+	kept := list[:0]
+	for _, s := range list {
+		if s != str {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// titleCase converts upper case USPS names to the title case of the CSV database, e.g. "SAINT PAUL".
+func titleCase(str string) string {
+	b := []byte(strings.ToLower(str))
+	for i := range b {
+		if i == 0 || b[i-1] == ' ' || b[i-1] == '-' {
+			if b[i] >= 'a' && b[i] <= 'z' {
+				b[i] -= 'a' - 'A'
+			}
+		}
+	}
+	return string(b)
+}
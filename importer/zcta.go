@@ -0,0 +1,248 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools"
+)
+
+// zctaProps are the feature properties that may hold a ZCTA code, in order of preference.
+var zctaProps = []string{"ZCTA5CE20", "ZCTA5CE10", "GEOID20", "GEOID10", "ZCTA5", "ZIP"}
+
+type feature struct {
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+// addBoundaries reads a GeoJSON FeatureCollection with ZCTA boundaries, simplifies
+// the polygons and puts them into the database along with the grid cells they cover.
+func (d *builder) addBoundaries(r io.Reader) (n int, err error) {
+	// begin a writing transaction
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var boundaries *bolt.Bucket
+	var cells *bolt.Bucket
+	if boundaries, err = tx.CreateBucketIfNotExists(boundariesBuck); err != nil {
+		return
+	}
+	if cells, err = tx.CreateBucketIfNotExists(boundaryCellsBuck); err != nil {
+		return
+	}
+
+	dec := json.NewDecoder(r)
+	if err = seekFeatures(dec); err != nil {
+		return
+	}
+	for dec.More() {
+		var feat feature
+		if err = dec.Decode(&feat); err != nil {
+			return
+		}
+		if err = d.tick(); err != nil {
+			return
+		}
+		zip, ok := featureZip(feat)
+		if !ok {
+			d.logln("importer: ignored a ZCTA feature without a zip code")
+			continue
+		}
+		if !d.hasZip(tx, zip) {
+			continue
+		}
+		boundary, err := featureBoundary(feat)
+		if err != nil {
+			d.logln("importer: ignored a ZCTA feature due to an error", zip, err)
+			continue
+		}
+		boundary = simplifyBoundary(boundary, d.opts.Simplify)
+		if len(boundary) == 0 {
+			continue
+		}
+		// the cells of a boundary put before, e.g. by merged inputs, don't cover this one
+		if err = deleteBoundaryCells(boundaries, cells, zip); err != nil {
+			return n, err
+		}
+		// zip = boundary
+		if err = boundaries.Put(zip.Bytes(), boundary.Bytes()); err != nil {
+			return n, err
+		}
+		// grid cell + zip
+		for _, cell := range ziptools.CoveringCells(boundary.Bounds()) {
+			if err = cells.Put(cell.Key(zip), []byte{}); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
+
+// deleteBoundaryCells deletes the grid cells of the boundary of the zip code if it has one.
+func deleteBoundaryCells(boundaries, cells *bolt.Bucket, zip ziptools.Zip) error {
+	var prev ziptools.Boundary
+	if err := prev.Decode(boundaries.Get(zip.Bytes())); err != nil || len(prev) == 0 {
+		return err
+	}
+	for _, cell := range ziptools.CoveringCells(prev.Bounds()) {
+		if err := cells.Delete(cell.Key(zip)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seekFeatures advances the decoder to the first element of the features array.
+func seekFeatures(dec *json.Decoder) error {
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("importer: ZCTA file is not a GeoJSON object")
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if t == "features" {
+			if t, err = dec.Token(); err != nil {
+				return err
+			} else if t != json.Delim('[') {
+				return fmt.Errorf("importer: GeoJSON features is not an array")
+			}
+			return nil
+		}
+		// skip the value
+		var skip json.RawMessage
+		if err = dec.Decode(&skip); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("importer: ZCTA file is not a GeoJSON FeatureCollection")
+}
+
+func featureZip(feat feature) (zip ziptools.Zip, ok bool) {
+	for _, prop := range zctaProps {
+		for k, v := range feat.Properties {
+			if !strings.EqualFold(k, prop) {
+				continue
+			}
+			if str, ok := v.(string); ok && len(str) == ziptools.ZipLen {
+				return ziptools.NewZip(str), true
+			}
+		}
+	}
+	return
+}
+
+func featureBoundary(feat feature) (ziptools.Boundary, error) {
+	switch feat.Geometry.Type {
+	case "Polygon":
+		var coords [][][]float64
+		if err := json.Unmarshal(feat.Geometry.Coordinates, &coords); err != nil {
+			return nil, err
+		}
+		return ziptools.Boundary{newPolygon(coords)}, nil
+	case "MultiPolygon":
+		var coords [][][][]float64
+		if err := json.Unmarshal(feat.Geometry.Coordinates, &coords); err != nil {
+			return nil, err
+		}
+		boundary := make(ziptools.Boundary, 0, len(coords))
+		for _, c := range coords {
+			boundary = append(boundary, newPolygon(c))
+		}
+		return boundary, nil
+	}
+	return nil, fmt.Errorf("unsupported geometry type %q", feat.Geometry.Type)
+}
+
+// newPolygon converts GeoJSON positions [lon, lat] into a polygon.
+func newPolygon(coords [][][]float64) ziptools.Polygon {
+	polygon := make(ziptools.Polygon, 0, len(coords))
+	for _, c := range coords {
+		ring := make(ziptools.Ring, 0, len(c))
+		for _, pos := range c {
+			if len(pos) < 2 {
+				continue
+			}
+			ring = append(ring, ziptools.Point{Lat: pos[1], Lon: pos[0]})
+		}
+		polygon = append(polygon, ring)
+	}
+	return polygon
+}
+
+// simplifyBoundary simplifies every ring of the boundary, rings that would
+// degenerate are kept intact. Polygons without an outer ring are dropped.
+func simplifyBoundary(boundary ziptools.Boundary, tolerance float64) ziptools.Boundary {
+	out := make(ziptools.Boundary, 0, len(boundary))
+	for _, p := range boundary {
+		if len(p) == 0 || len(p[0]) < 4 {
+			continue
+		}
+		polygon := make(ziptools.Polygon, 0, len(p))
+		for _, r := range p {
+			if s := simplifyRing(r, tolerance); len(s) >= 4 {
+				polygon = append(polygon, s)
+			} else {
+				polygon = append(polygon, r)
+			}
+		}
+		out = append(out, polygon)
+	}
+	return out
+}
+
+// simplifyRing implements the Douglas-Peucker algorithm.
+func simplifyRing(r ziptools.Ring, tolerance float64) ziptools.Ring {
+	if tolerance <= 0 || len(r) < 3 {
+		return r
+	}
+	keep := make([]bool, len(r))
+	keep[0], keep[len(r)-1] = true, true
+	stack := [][2]int{{0, len(r) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := span[0], span[1]
+		max, idx := 0.0, -1
+		for i := first + 1; i < last; i++ {
+			if dist := segmentDistance(r[i], r[first], r[last]); dist > max {
+				max, idx = dist, i
+			}
+		}
+		if idx >= 0 && max > tolerance {
+			keep[idx] = true
+			stack = append(stack, [2]int{first, idx}, [2]int{idx, last})
+		}
+	}
+	out := make(ziptools.Ring, 0, len(r))
+	for i, pt := range r {
+		if keep[i] {
+			out = append(out, pt)
+		}
+	}
+	return out
+}
+
+// segmentDistance returns the planar distance in degrees from the point to the segment.
+func segmentDistance(p, a, b ziptools.Point) float64 {
+	dx, dy := b.Lon-a.Lon, b.Lat-a.Lat
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.Lon-a.Lon, p.Lat-a.Lat)
+	}
+	t := ((p.Lon-a.Lon)*dx + (p.Lat-a.Lat)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.Lon-(a.Lon+t*dx), p.Lat-(a.Lat+t*dy))
+}
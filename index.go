@@ -0,0 +1,112 @@
+package ziptools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// SubstringPolicy limits the substrings of cities, zip codes and postal codes that are indexed
+// to find them. The zero policy indexes every prefix and every suffix. The policy of a database is
+// recorded along with it, queries that it can't answer fail with a QueryError.
+type SubstringPolicy struct {
+	// MinLength is the minimum length of substrings in characters, shorter queries can't be answered.
+	MinLength int `json:"min_length,omitempty"`
+	// MaxLength is the maximum length of substrings in characters, zero means no limit.
+	// Longer queries can't be answered.
+	MaxLength int `json:"max_length,omitempty"`
+	// PrefixOnly indexes prefixes only, queries match the beginning of names and codes then.
+	PrefixOnly bool `json:"prefix_only,omitempty"`
+	// MaxPostings caps the number of entries per substring, zero means no limit.
+	// Longer lists are truncated, so queries of common substrings find only a part of the matches.
+	// The write API doesn't refill truncated lists when entries are removed, they may hold fewer
+	// entries than a new import would then.
+	MaxPostings int `json:"max_postings,omitempty"`
+}
+
+// Check reports whether the limits of the policy are consistent.
+func (p SubstringPolicy) Check() error {
+	switch {
+	case p.MinLength < 0 || p.MaxLength < 0 || p.MaxPostings < 0:
+		return errors.New("ziptools: substring limits must not be negative")
+	case p.MaxLength > 0 && p.MaxLength < p.MinLength:
+		return errors.New("ziptools: maximum substring length is less than the minimum")
+	}
+	return nil
+}
+
+// Substrings calls fn with every substring of str that is indexed by the policy, each substring once.
+func (p SubstringPolicy) Substrings(str string, fn func(substr string)) {
+	seen := make(map[string]struct{})
+	put := func(substr string) {
+		if n := utf8.RuneCountInString(substr); n < 1 || n < p.MinLength || p.MaxLength > 0 && n > p.MaxLength {
+			return
+		}
+		if _, ok := seen[substr]; ok {
+			return
+		}
+		seen[substr] = struct{}{}
+		fn(substr)
+	}
+	for i := range str {
+		put(str[0:i])
+	}
+	if p.PrefixOnly {
+		put(str)
+		return
+	}
+	for i := range str {
+		put(str[i:])
+	}
+}
+
+// matches reports whether the lowercase substr is indexed by the policy as a substring of the lowercase str.
+func (p SubstringPolicy) matches(str, substr string) bool {
+	return strings.HasPrefix(str, substr) || !p.PrefixOnly && strings.HasSuffix(str, substr)
+}
+
+// CheckQuery returns a QueryError if the query can't be answered by the index.
+func (p SubstringPolicy) CheckQuery(query string) error {
+	n := utf8.RuneCountInString(query)
+	switch {
+	case n < p.MinLength:
+		return &QueryError{Query: query, Reason: fmt.Sprintf("substrings shorter than %d characters are not indexed", p.MinLength)}
+	case p.MaxLength > 0 && n > p.MaxLength:
+		return &QueryError{Query: query, Reason: fmt.Sprintf("substrings longer than %d characters are not indexed", p.MaxLength)}
+	}
+	return nil
+}
+
+// Bytes returns a serialized version of a substring policy.
+func (p SubstringPolicy) Bytes() []byte {
+	b, _ := json.Marshal(p)
+	return b
+}
+
+// FromBytes constructs a new substring policy from bytes. Malformed data yields the default policy.
+func (p *SubstringPolicy) FromBytes(b []byte) *SubstringPolicy {
+	p.Decode(b)
+	return p
+}
+
+// Decode decodes a substring policy from bytes, the policy is the default one on errors.
+func (p *SubstringPolicy) Decode(b []byte) error {
+	*p = SubstringPolicy{}
+	if json.Unmarshal(b, p) != nil {
+		*p = SubstringPolicy{}
+		return ErrMalformedRecord
+	}
+	return nil
+}
+
+// QueryError reports a query that the substring index of a database can't answer.
+type QueryError struct {
+	Query  string
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("ziptools: can't find %q: %s", e.Query, e.Reason)
+}
@@ -0,0 +1,61 @@
+package ziptools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func substringsOf(p SubstringPolicy, str string) (list []string) {
+	p.Substrings(str, func(substr string) {
+		list = append(list, substr)
+	})
+	return
+}
+
+func TestSubstringPolicySubstrings(t *testing.T) {
+	assert.Equal(t, []string{"a", "ab", "abc", "bc", "c"}, substringsOf(SubstringPolicy{}, "abc"))
+	assert.Equal(t, []string{"a", "ab", "abc"}, substringsOf(SubstringPolicy{PrefixOnly: true}, "abc"))
+	assert.Equal(t, []string{"ab", "abc", "bc"}, substringsOf(SubstringPolicy{MinLength: 2}, "abc"))
+	assert.Equal(t, []string{"ab", "abc", "abcd"}, substringsOf(SubstringPolicy{MinLength: 2, MaxLength: 4, PrefixOnly: true}, "abcde"))
+	// lengths are counted in characters
+	assert.Equal(t, []string{"zü", "zür"}, substringsOf(SubstringPolicy{MinLength: 2, PrefixOnly: true}, "zür"))
+}
+
+func TestSubstringPolicyCheck(t *testing.T) {
+	assert.NoError(t, SubstringPolicy{}.Check())
+	assert.NoError(t, SubstringPolicy{MinLength: 3, MaxLength: 3}.Check())
+	assert.Error(t, SubstringPolicy{MinLength: 3, MaxLength: 2}.Check())
+	assert.Error(t, SubstringPolicy{MaxPostings: -1}.Check())
+}
+
+func TestSubstringPolicyCheckQuery(t *testing.T) {
+	p := SubstringPolicy{MinLength: 2, MaxLength: 4}
+	assert.NoError(t, p.CheckQuery("ab"))
+	assert.NoError(t, p.CheckQuery("züri"))
+	err := p.CheckQuery("a")
+	if qerr, ok := err.(*QueryError); assert.True(t, ok) {
+		assert.Equal(t, "a", qerr.Query)
+	}
+	assert.Error(t, p.CheckQuery("abcde"))
+}
+
+func TestSubstringPolicyBytes(t *testing.T) {
+	p := SubstringPolicy{MinLength: 2, PrefixOnly: true, MaxPostings: 100}
+	var got SubstringPolicy
+	assert.Equal(t, p, *got.FromBytes(p.Bytes()))
+}
+
+func FuzzSubstringPolicy(f *testing.F) {
+	f.Add(SubstringPolicy{MinLength: 2, PrefixOnly: true, MaxPostings: 100}.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p SubstringPolicy
+		if p.Decode(data) != nil {
+			assert.Equal(t, SubstringPolicy{}, p)
+			return
+		}
+		var got SubstringPolicy
+		assert.NoError(t, got.Decode(p.Bytes()))
+		assert.Equal(t, p, got)
+	})
+}
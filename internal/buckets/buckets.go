@@ -0,0 +1,44 @@
+// Package buckets holds the names of Bolt buckets shared by the database and its importer.
+package buckets
+
+import "strings"
+
+var (
+	Cities         = []byte("cities")
+	Locodes        = []byte("locodes")
+	Locations      = []byte("locations")
+	Zips           = []byte("zips")
+	SubZips        = []byte("subzips")
+	SubCities      = []byte("subcities")
+	SubLocodes     = []byte("sublocodes")
+	LocodeCells    = []byte("locodecells")
+	ZipInfo        = []byte("zipinfo")
+	ZipCells       = []byte("zipcells")
+	Boundaries     = []byte("boundaries")
+	BoundaryCells  = []byte("boundarycells")
+	Geohashes      = []byte("geohashes")
+	ZipGeohashes   = []byte("zipgeohashes")
+	CityInfo       = []byte("cityinfo")
+	PostalCodes    = []byte("postalcodes")
+	PostalCities   = []byte("postalcities")
+	SubPostalCodes = []byte("subpostalcodes")
+	CountyShares   = []byte("countyshares")
+	CityCases      = []byte("citycases")
+	Meta           = []byte("meta")
+)
+
+// CityCaseKey returns the key of the city name in CityCases: the lowercase name, a zero byte and the name.
+// Names are found by their lowercase names with a prefix scan.
+func CityCaseKey(name string) []byte {
+	return []byte(strings.ToLower(name) + "\x00" + name)
+}
+
+// Keys of the meta bucket.
+var (
+	// MetaSubstrings is the key of the substring policy the database is indexed with.
+	MetaSubstrings = []byte("substrings")
+	// MetaSchema is the key of the decimal schema version of the database.
+	MetaSchema = []byte("schema")
+	// MetaDataset is the key of the metadata of the build: sources, counts and index options.
+	MetaDataset = []byte("dataset")
+)
@@ -0,0 +1,112 @@
+package ziptools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools/internal/buckets"
+)
+
+// SchemaVersion is the version of the layout of databases and the encodings of their records
+// that this package reads and the importer writes. Databases built before the version was
+// recorded are of version 0, Open refuses databases of versions above SchemaVersion.
+// DB.Migrate upgrades databases of earlier versions in place.
+const SchemaVersion = 4
+
+// Metadata describes how a database has been built: the data it's built from, when and how.
+type Metadata struct {
+	SchemaVersion int `json:"schema_version"`
+	// Built is the time the build completed at, zero for databases without metadata.
+	Built time.Time `json:"built"`
+	// Modified is the time of the last change through the write API, e.g. DB.PutZip.
+	Modified time.Time `json:"modified"`
+	// Sources are the input files in the order of import.
+	Sources []Source `json:"sources,omitempty"`
+	// Counts are the numbers of records per bucket, e.g. "zipinfo" or "locations".
+	Counts map[string]int `json:"counts,omitempty"`
+	Index  IndexOptions   `json:"index"`
+}
+
+// Source is an input file of a database.
+type Source struct {
+	// Kind of the source, e.g. "zips", "locodes" or "zcta".
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// SHA256 is the hex checksum of the file as read, i.e. before decompression.
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// IndexOptions are the options the indexes of a database are built with.
+type IndexOptions struct {
+	Substrings SubstringPolicy `json:"substrings"`
+	// Aliases reports whether acceptable city aliases of zip codes are indexed as cities.
+	Aliases bool `json:"aliases,omitempty"`
+	// GeohashPrecision is the precision of zip code geohashes.
+	GeohashPrecision int `json:"geohash_precision,omitempty"`
+	// Simplify is the tolerance in degrees ZCTA boundaries are simplified with.
+	Simplify float64 `json:"simplify,omitempty"`
+}
+
+// Bytes returns a serialized version of metadata.
+func (m Metadata) Bytes() []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+// Decode decodes metadata from bytes, the metadata is empty on errors.
+func (m *Metadata) Decode(b []byte) error {
+	*m = Metadata{}
+	if json.Unmarshal(b, m) != nil {
+		*m = Metadata{}
+		return ErrMalformedRecord
+	}
+	return nil
+}
+
+// SchemaError reports a database of a schema version that this package doesn't understand.
+type SchemaError struct {
+	Path    string
+	Version int
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("ziptools: %s has schema version %d, only versions up to %d are supported", e.Path, e.Version, SchemaVersion)
+}
+
+// readSchema reads the schema version of a database, zero if it's not recorded.
+func readSchema(tx *bolt.Tx) (int, error) {
+	b := tx.Bucket(metaBuck)
+	if b == nil {
+		return 0, nil
+	}
+	v := b.Get(buckets.MetaSchema)
+	if v == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(v))
+	if err != nil || version < 0 {
+		return 0, ErrMalformedRecord
+	}
+	return version, nil
+}
+
+// Metadata gets the metadata of the database. Databases built before metadata was recorded
+// only have the schema version and the substring policy.
+func (d *DB) Metadata() (meta *Metadata, err error) {
+	meta = &Metadata{}
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(metaBuck); b != nil {
+			if v := b.Get(buckets.MetaDataset); v != nil {
+				return meta.Decode(v)
+			}
+		}
+		return nil
+	})
+	meta.SchemaVersion = d.schema
+	meta.Index.Substrings = d.index.Substrings
+	return
+}
@@ -0,0 +1,65 @@
+package ziptools
+
+import (
+	"log"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/xlab/ziptools/internal/buckets"
+)
+
+func TestOpenSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.db")
+	bdb, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	assert.NoError(t, bdb.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(metaBuck)
+		if err != nil {
+			return err
+		}
+		return b.Put(buckets.MetaSchema, []byte(strconv.Itoa(SchemaVersion+1)))
+	}))
+	assert.NoError(t, bdb.Close())
+
+	db, err := Open(path)
+	assert.Nil(t, db)
+	assert.Equal(t, &SchemaError{Path: path, Version: SchemaVersion + 1}, err)
+}
+
+func TestMetadata(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	meta, err := db.Metadata()
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, meta.SchemaVersion)
+	assert.Equal(t, db.SubstringPolicy(), meta.Index.Substrings)
+	if assert.NotEmpty(t, meta.Sources) {
+		assert.Len(t, meta.Sources[0].SHA256, 64)
+	}
+	assert.NotZero(t, meta.Counts["zipinfo"])
+}
+
+func FuzzMetadata(f *testing.F) {
+	f.Add(Metadata{
+		SchemaVersion: SchemaVersion,
+		Sources:       []Source{{Kind: "zips", Name: "zips.csv", SHA256: "00", Size: 1}},
+		Counts:        map[string]int{"zipinfo": 1},
+	}.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var meta Metadata
+		if meta.Decode(data) != nil {
+			return
+		}
+		var got Metadata
+		assert.NoError(t, got.Decode(meta.Bytes()))
+		assert.Equal(t, meta.Bytes(), got.Bytes())
+	})
+}
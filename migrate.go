@@ -0,0 +1,246 @@
+package ziptools
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools/internal/buckets"
+)
+
+// migration upgrades a database of the previous schema version to its version.
+type migration struct {
+	version     int
+	description string
+	migrate     func(tx *bolt.Tx, step *MigrationStep) error
+}
+
+// migrations upgrade databases one schema version at a time, the n-th of them upgrades version n to n+1.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "re-encode zip and locode lists with a varint length and locations as binary records",
+		migrate:     migrateRecords,
+	},
+	{
+		version:     2,
+		description: "index the names of cities by their lowercase names",
+		migrate:     migrateCityCases,
+	},
+	{
+		version:     3,
+		description: "record the zip codes of databases built without zip code details in zipinfo",
+		migrate:     migrateZipInfos,
+	},
+	{
+		version:     4,
+		description: "prefix boundaries with the version of their encoding",
+		migrate:     migrateBoundaries,
+	},
+}
+
+// MigrateOptions configure a migration.
+type MigrateOptions struct {
+	// DryRun reports what a migration would change and leaves the database intact.
+	DryRun bool
+}
+
+// MigrationReport is the outcome of a migration.
+type MigrationReport struct {
+	From   int             `json:"from"`
+	To     int             `json:"to"`
+	DryRun bool            `json:"dry_run,omitempty"`
+	Steps  []MigrationStep `json:"steps,omitempty"`
+}
+
+// MigrationStep is a numbered migration applied to a database.
+type MigrationStep struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	// Changes counts the values rewritten per bucket.
+	Changes map[string]int `json:"changes,omitempty"`
+}
+
+// Migrate upgrades the database to SchemaVersion in place. Migrations are applied in order within
+// a single transaction, the database is left at its version if any of them fails.
+func (d *DB) Migrate(opts MigrateOptions) (rpt *MigrationReport, err error) {
+	rpt = &MigrationReport{From: d.schema, To: d.schema, DryRun: opts.DryRun}
+	if d.schema >= SchemaVersion {
+		return
+	}
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	for _, m := range migrations[d.schema:] {
+		step := MigrationStep{Version: m.version, Description: m.description, Changes: make(map[string]int)}
+		if err = m.migrate(tx, &step); err != nil {
+			return
+		}
+		rpt.Steps = append(rpt.Steps, step)
+		rpt.To = m.version
+	}
+	b, err := tx.CreateBucketIfNotExists(metaBuck)
+	if err != nil {
+		return
+	}
+	if err = b.Put(buckets.MetaSchema, []byte(strconv.Itoa(rpt.To))); err != nil {
+		return
+	}
+	// a dry run rolls the changes back
+	if opts.DryRun {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	d.schema = rpt.To
+	return
+}
+
+// migrateRecords re-encodes the lists and the locations of databases built before records were versioned.
+func migrateRecords(tx *bolt.Tx, step *MigrationStep) error {
+	for _, name := range [][]byte{citiesBuck, subZipsBuck, subCitiesBuck} {
+		if err := reencode(tx, name, step, func(v []byte) ([]byte, error) {
+			var list ZipList
+			err := list.Decode(v)
+			return list.Bytes(), err
+		}); err != nil {
+			return err
+		}
+	}
+	for _, name := range [][]byte{locodesBuck, subLocodesBuck, locodeCellsBuck} {
+		if err := reencode(tx, name, step, func(v []byte) ([]byte, error) {
+			var list LocodeList
+			err := list.Decode(v)
+			return list.Bytes(), err
+		}); err != nil {
+			return err
+		}
+	}
+	return reencode(tx, locationsBuck, step, func(v []byte) ([]byte, error) {
+		var loc Location
+		err := loc.Decode(v)
+		return loc.Bytes(), err
+	})
+}
+
+// migrateCityCases indexes the names of the cities by their lowercase names for the write API.
+func migrateCityCases(tx *bolt.Tx, step *MigrationStep) error {
+	cities := tx.Bucket(citiesBuck)
+	if cities == nil {
+		return nil
+	}
+	cases, err := tx.CreateBucketIfNotExists(cityCasesBuck)
+	if err != nil {
+		return err
+	}
+	// keys can't be put while iterating
+	var keys [][]byte
+	if err = cities.ForEach(func(k, v []byte) error {
+		keys = append(keys, buckets.CityCaseKey(string(k)))
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err = cases.Put(k, []byte{}); err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		step.Changes[string(cityCasesBuck)] += len(keys)
+	}
+	return nil
+}
+
+// migrateZipInfos records the zip codes of the cities that have no details with their city, the write API
+// finds the indexes of zip codes through their details. The zips bucket names the city where it has the zip code.
+func migrateZipInfos(tx *bolt.Tx, step *MigrationStep) error {
+	cities := tx.Bucket(citiesBuck)
+	if cities == nil {
+		return nil
+	}
+	infos, err := tx.CreateBucketIfNotExists(zipInfoBuck)
+	if err != nil {
+		return err
+	}
+	zips := tx.Bucket(zipsBuck)
+	// values can't be put while iterating
+	var added []ZipInfo
+	seen := make(map[Zip]bool)
+	if err = cities.ForEach(func(k, v []byte) error {
+		var list ZipList
+		if err := list.Decode(v); err != nil {
+			return fmt.Errorf("ziptools: %s %q: %v", citiesBuck, k, err)
+		}
+		for _, zip := range list {
+			if seen[zip] || infos.Get(zip.Bytes()) != nil {
+				continue
+			}
+			seen[zip] = true
+			info := ZipInfo{Zip: zip, City: string(k)}
+			if zips != nil {
+				if city := zips.Get(zip.Bytes()); city != nil {
+					info.City = string(city)
+				}
+			}
+			added = append(added, info)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, info := range added {
+		if err = infos.Put(info.Zip.Bytes(), info.Bytes()); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		step.Changes[string(zipInfoBuck)] += len(added)
+	}
+	return nil
+}
+
+// migrateBoundaries re-encodes the boundaries of databases built before boundaries were versioned.
+func migrateBoundaries(tx *bolt.Tx, step *MigrationStep) error {
+	return reencode(tx, boundariesBuck, step, func(v []byte) ([]byte, error) {
+		var b Boundary
+		err := b.decodeLegacy(v)
+		return b.Bytes(), err
+	})
+}
+
+// reencode rewrites the values of the bucket whose encoding changes, missing buckets are skipped.
+func reencode(tx *bolt.Tx, name []byte, step *MigrationStep, encode func(v []byte) ([]byte, error)) error {
+	b := tx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+	// values can't be put while iterating
+	var keys, values [][]byte
+	if err := b.ForEach(func(k, v []byte) error {
+		value, err := encode(v)
+		if err != nil {
+			return fmt.Errorf("ziptools: %s %q: %v", name, k, err)
+		}
+		if !bytes.Equal(v, value) {
+			keys = append(keys, append([]byte(nil), k...))
+			values = append(values, value)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if err := b.Put(k, values[i]); err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		step.Changes[string(name)] += len(keys)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package ziptools
+
+import (
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/xlab/ziptools/internal/buckets"
+)
+
+// legacyDB creates a database of schema version 0 with lists of the legacy encoding and JSON locations.
+func legacyDB(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	bdb, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	assert.NoError(t, bdb.Update(func(tx *bolt.Tx) error {
+		puts := []struct {
+			buck, key, value []byte
+		}{
+			{citiesBuck, []byte("Syracuse"), []byte("\x021325213261")},
+			{zipsBuck, []byte("13252"), []byte("Syracuse")},
+			{zipsBuck, []byte("13261"), []byte("Syracuse")},
+			// boundaries without a version
+			{boundariesBuck, []byte("13252"), testBoundary.Bytes()[1:]},
+			{subZipsBuck, []byte("1325"), []byte("\x0113252")},
+			{locodesBuck, []byte("Syracuse"), []byte("\x01SYR")},
+			{locationsBuck, []byte("SYR"), []byte(`{"Name":"Syracuse","State":"NY","Locode":"SYR"}`)},
+			// already in the current encoding
+			{locationsBuck, []byte("ABB"), Location{Name: "Abbeville", State: "AL", Locode: NewLocode("ABB")}.Bytes()},
+		}
+		for _, p := range puts {
+			b, err := tx.CreateBucketIfNotExists(p.buck)
+			if err != nil {
+				return err
+			}
+			if err = b.Put(p.key, p.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	assert.NoError(t, bdb.Close())
+	return path
+}
+
+func TestMigrations(t *testing.T) {
+	assert.Len(t, migrations, SchemaVersion)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := Open(legacyDB(t))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	raw := func(buck, key []byte) (v []byte) {
+		db.db.View(func(tx *bolt.Tx) error {
+			v = append(v, tx.Bucket(buck).Get(key)...)
+			return nil
+		})
+		return
+	}
+
+	// the indexes of earlier versions aren't maintained
+	assert.Equal(t, errSchema, db.DeleteZip(NewZip("13252")))
+	// boundaries without a version are read before the migration
+	boundary, err := db.GetBoundary(NewZip("13252"))
+	assert.NoError(t, err)
+	assert.Equal(t, testBoundary, boundary)
+
+	rpt, err := db.Migrate(MigrateOptions{DryRun: true})
+	assert.NoError(t, err)
+	exp := &MigrationReport{From: 0, To: 4, DryRun: true, Steps: []MigrationStep{{
+		Version:     1,
+		Description: migrations[0].description,
+		Changes:     map[string]int{"cities": 1, "subzips": 1, "locodes": 1, "locations": 1},
+	}, {
+		Version:     2,
+		Description: migrations[1].description,
+		Changes:     map[string]int{"citycases": 1},
+	}, {
+		Version:     3,
+		Description: migrations[2].description,
+		Changes:     map[string]int{"zipinfo": 2},
+	}, {
+		Version:     4,
+		Description: migrations[3].description,
+		Changes:     map[string]int{"boundaries": 1},
+	}}}
+	assert.Equal(t, exp, rpt)
+	assert.Equal(t, []byte("\x01SYR"), raw(locodesBuck, []byte("Syracuse")))
+	meta, err := db.Metadata()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, meta.SchemaVersion)
+
+	rpt, err = db.Migrate(MigrateOptions{})
+	assert.NoError(t, err)
+	exp.DryRun = false
+	assert.Equal(t, exp, rpt)
+	assert.Equal(t, LocodeList{NewLocode("SYR")}.Bytes(), raw(locodesBuck, []byte("Syracuse")))
+	assert.Equal(t, []byte("4"), raw(metaBuck, buckets.MetaSchema))
+	assert.NoError(t, db.db.View(func(tx *bolt.Tx) error {
+		assert.NotNil(t, tx.Bucket(cityCasesBuck).Get(buckets.CityCaseKey("Syracuse")))
+		return nil
+	}))
+	zips, err := db.GetZips("Syracuse")
+	assert.NoError(t, err)
+	assert.Equal(t, ZipList{NewZip("13252"), NewZip("13261")}, zips)
+	boundary, err = db.GetBoundary(NewZip("13252"))
+	assert.NoError(t, err)
+	assert.Equal(t, testBoundary, boundary)
+	loc, err := db.GetLocation(NewLocode("SYR"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Location{Name: "Syracuse", State: "NY", Locode: NewLocode("SYR")}, loc)
+
+	rpt, err = db.Migrate(MigrateOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, &MigrationReport{From: 4, To: 4}, rpt)
+
+	// zip codes put again replace their entries
+	zip := NewZip("13252")
+	assert.NoError(t, db.PutZip(ZipInfo{Zip: zip, City: "Syracuse", State: "NY", Population: 10}))
+	zips, err = db.GetZips("Syracuse")
+	assert.NoError(t, err)
+	assert.Equal(t, ZipList{zip, NewZip("13261")}, zips)
+	assert.Equal(t, ZipList{zip}.Bytes(), raw(subZipsBuck, []byte("1325")))
+	info, err := db.GetZipInfo(zip)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, info.Population)
+}
+
+func TestOpenMigrate(t *testing.T) {
+	path := legacyDB(t)
+	db, err := OpenWithOptions(path, OpenOptions{Migrate: true})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	db.Close()
+	db, err = Open(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	meta, err := db.Metadata()
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, meta.SchemaVersion)
+}
@@ -0,0 +1,186 @@
+package ziptools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+)
+
+// CountryUS is the country of zip codes.
+const CountryUS = "US"
+
+// PostalCode represents a country qualified postal code of variable length, e.g. CA "K1A0B1".
+// Codes are kept normalized: upper case with no spaces or dashes.
+type PostalCode struct {
+	// Country is an ISO 3166-1 alpha-2 country code.
+	Country string
+	Code    string
+}
+
+// NewPostalCode creates a new postal code from strings, normalizing both parts.
+// The postal code is empty if the country isn't two letters.
+func NewPostalCode(country, code string) PostalCode {
+	if country = strings.ToUpper(strings.TrimSpace(country)); !isCountry(country) {
+		return PostalCode{}
+	}
+	code = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+	return PostalCode{
+		Country: country,
+		Code:    strings.ToUpper(code),
+	}
+}
+
+// isCountry reports whether the string is an upper case alpha-2 country code.
+func isCountry(country string) bool {
+	return len(country) == 2 &&
+		country[0] >= 'A' && country[0] <= 'Z' &&
+		country[1] >= 'A' && country[1] <= 'Z'
+}
+
+// PostalCodeFromZip creates a US postal code from a zip code.
+func PostalCodeFromZip(z Zip) PostalCode {
+	return PostalCode{Country: CountryUS, Code: z.String()}
+}
+
+// IsZip reports whether the postal code is a US zip code.
+func (p PostalCode) IsZip() bool {
+	return p.Country == CountryUS
+}
+
+// Zip returns the postal code as a US zip code.
+func (p PostalCode) Zip() Zip {
+	return NewZip(p.Code)
+}
+
+// String represents a postal code as a string, e.g. "CA K1A0B1".
+func (p PostalCode) String() string {
+	return p.Country + " " + p.Code
+}
+
+// Key returns a database key of the postal code. US postal codes use their zip code as a key.
+func (p PostalCode) Key() []byte {
+	if p.IsZip() {
+		return p.Zip().Bytes()
+	}
+	return []byte(p.Country + p.Code)
+}
+
+// MarshalJSON represents a postal code as a string while marshaling as JSON.
+func (p PostalCode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON restores a postal code from bytes after marshaling as JSON.
+func (p *PostalCode) UnmarshalJSON(b []byte) (err error) {
+	var str string
+	if err = json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+	if idx := strings.Index(str, " "); idx > 0 {
+		*p = NewPostalCode(str[:idx], str[idx+1:])
+	} else {
+		*p = PostalCode{}
+	}
+	return
+}
+
+// PostalCodeInfo represents the details of a postal code.
+type PostalCodeInfo struct {
+	PostalCode PostalCode
+	City       string
+	State      string
+	County     string  `json:",omitempty"`
+	Latitude   float64 `json:",omitempty"`
+	Longitude  float64 `json:",omitempty"`
+}
+
+// Bytes returns a serialized version of a postal code info.
+func (p PostalCodeInfo) Bytes() []byte {
+	b, _ := json.Marshal(p)
+	return b
+}
+
+// FromBytes constructs a new postal code info from bytes. Malformed data yields an empty postal code info.
+func (p *PostalCodeInfo) FromBytes(b []byte) *PostalCodeInfo {
+	p.Decode(b)
+	return p
+}
+
+// Decode decodes a postal code info from bytes, the postal code info is empty on errors.
+func (p *PostalCodeInfo) Decode(b []byte) error {
+	*p = PostalCodeInfo{}
+	if json.Unmarshal(b, p) != nil {
+		*p = PostalCodeInfo{}
+		return ErrMalformedRecord
+	}
+	return nil
+}
+
+// PostalCodeList represents a list of postal codes.
+type PostalCodeList []PostalCode
+
+// Range returns a sliced variant of a postal code list.
+func (p PostalCodeList) Range(offset, limit int) PostalCodeList {
+	if offset < 0 || offset >= len(p) {
+		return PostalCodeList{}
+	}
+	if offset+limit > len(p) {
+		limit = len(p) - offset
+	}
+	return p[offset : offset+limit]
+}
+
+// Bytes returns a serialized version of a postal code list. The length is a uvarint,
+// every code is prefixed with its two letter country and its length as a uvarint.
+//
+//  [N][country1][len1][code1]...[countryN][lenN][codeN]
+func (p PostalCodeList) Bytes() []byte {
+	var buf bytes.Buffer
+	tmp := make([]byte, binary.MaxVarintLen64)
+	buf.Write(tmp[:binary.PutUvarint(tmp, uint64(len(p)))])
+	for _, code := range p {
+		buf.WriteString(code.Country)
+		buf.Write(tmp[:binary.PutUvarint(tmp, uint64(len(code.Code)))])
+		buf.WriteString(code.Code)
+	}
+	return buf.Bytes()
+}
+
+// FromBytes constructs a new postal code list from bytes. Malformed data yields an empty list.
+func (p *PostalCodeList) FromBytes(b []byte) PostalCodeList {
+	p.Decode(b)
+	return *p
+}
+
+// Decode decodes a postal code list from bytes, the list is nil on errors and for empty bytes.
+func (p *PostalCodeList) Decode(b []byte) error {
+	*p = nil
+	if len(b) == 0 {
+		return nil
+	}
+	r := recordReader{b: b}
+	// every code takes at least 3 bytes
+	list := make(PostalCodeList, r.count(3))
+	for i := range list {
+		country := string(r.next(2))
+		code := r.next(r.length())
+		if r.err != nil {
+			return r.err
+		}
+		if !isCountry(country) {
+			return ErrMalformedRecord
+		}
+		list[i] = PostalCode{Country: country, Code: string(code)}
+	}
+	if err := r.end(); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
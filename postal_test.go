@@ -0,0 +1,107 @@
+package ziptools
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPostalCode(t *testing.T) {
+	code := NewPostalCode("ca", "k1a 0b1")
+	assert.Equal(t, PostalCode{Country: "CA", Code: "K1A0B1"}, code)
+	assert.Equal(t, "CA K1A0B1", code.String())
+	assert.Equal(t, []byte("CAK1A0B1"), code.Key())
+	assert.False(t, code.IsZip())
+	zip := NewPostalCode("US", "12345")
+	assert.True(t, zip.IsZip())
+	assert.Equal(t, NewZip("12345"), zip.Zip())
+	assert.Equal(t, []byte("12345"), zip.Key())
+	assert.Equal(t, zip, PostalCodeFromZip(NewZip("12345")))
+	// countries are two letters
+	assert.Equal(t, PostalCode{}, NewPostalCode("CAN", "K1A0B1"))
+	assert.Equal(t, PostalCode{}, NewPostalCode("C", "K1A0B1"))
+	assert.Equal(t, PostalCode{}, NewPostalCode("C1", "K1A0B1"))
+}
+
+func TestPostalCodeMarshalJSON(t *testing.T) {
+	list := PostalCodeList{NewPostalCode("CA", "K1A 0B1"), NewPostalCode("GB", "SW1A 1AA")}
+	out, err := json.Marshal(list)
+	assert.NoError(t, err)
+	assert.Equal(t, `["CA K1A0B1","GB SW1A1AA"]`, string(out))
+	var got PostalCodeList
+	assert.NoError(t, json.Unmarshal(out, &got))
+	assert.Equal(t, list, got)
+}
+
+func TestPostalCodeListBytes(t *testing.T) {
+	list := PostalCodeList{NewPostalCode("CA", "K1A0B1"), NewPostalCode("GB", "SW1A1AA")}
+	exp := []byte("\x02CA\x06K1A0B1GB\x07SW1A1AA")
+	assert.Equal(t, exp, list.Bytes())
+}
+
+func TestPostalCodeListFromBytes(t *testing.T) {
+	data := []byte("\x02CA\x06K1A0B1GB\x07SW1A1AA")
+	exp := PostalCodeList{NewPostalCode("CA", "K1A0B1"), NewPostalCode("GB", "SW1A1AA")}
+	var list PostalCodeList
+	assert.Equal(t, exp, list.FromBytes(data))
+	assert.Empty(t, list.FromBytes(data[:len(data)-1]))
+	assert.Empty(t, list.FromBytes([]byte("\x05CA")))
+	assert.Empty(t, list.FromBytes(nil))
+
+	// lengths of long codes take more than a byte
+	long := PostalCodeList{NewPostalCode("CA", strings.Repeat("K", 300))}
+	data = long.Bytes()
+	assert.Equal(t, []byte("\x01CA\xac\x02"), data[:5])
+	assert.Equal(t, long, list.FromBytes(data))
+}
+
+func TestPostalCodeListDecode(t *testing.T) {
+	var list PostalCodeList
+	assert.NoError(t, list.Decode(nil))
+	data := []byte("\x02CA\x06K1A0B1GB\x07SW1A1AA")
+	assert.Equal(t, ErrMalformedRecord, list.Decode(data[:len(data)-1]))
+	assert.Equal(t, ErrMalformedRecord, list.Decode(append(data, 0)))
+	assert.Equal(t, ErrMalformedRecord, list.Decode([]byte("\xff\xff\xff\xff\x0fCA\x00")))
+	assert.Equal(t, ErrMalformedRecord, list.Decode([]byte("\x01C \x01K")))
+	assert.Nil(t, list)
+}
+
+func FuzzPostalCodeList(f *testing.F) {
+	f.Add(PostalCodeList{NewPostalCode("CA", "K1A0B1"), NewPostalCode("GB", "SW1A1AA")}.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var list PostalCodeList
+		if list.Decode(data) != nil {
+			assert.Nil(t, list)
+			return
+		}
+		var got PostalCodeList
+		assert.NoError(t, got.Decode(list.Bytes()))
+		assert.Equal(t, list.Bytes(), got.Bytes())
+	})
+}
+
+func FuzzPostalCodeInfo(f *testing.F) {
+	f.Add(PostalCodeInfo{PostalCode: NewPostalCode("CA", "K1A0B1"), City: "Ottawa", State: "ON", Latitude: 45.42}.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var info PostalCodeInfo
+		if info.Decode(data) != nil {
+			assert.Equal(t, PostalCodeInfo{}, info)
+			return
+		}
+		var got PostalCodeInfo
+		assert.NoError(t, got.Decode(info.Bytes()))
+		assert.Equal(t, info.Bytes(), got.Bytes())
+	})
+}
+
+func TestPostalCodeListRange(t *testing.T) {
+	data := PostalCodeList{
+		NewPostalCode("CA", "A"), NewPostalCode("CA", "B"), NewPostalCode("CA", "C"),
+	}
+	assert.Equal(t, data[1:], data.Range(1, 2))
+	assert.Equal(t, data[2:], data.Range(2, 10))
+	assert.Empty(t, data.Range(3, 1))
+	assert.Empty(t, data.Range(-1, 1))
+}
@@ -0,0 +1,113 @@
+package ziptools
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrMalformedRecord is returned when a stored record can't be decoded, e.g. it's truncated or corrupt.
+// DB methods return it instead of empty results.
+var ErrMalformedRecord = errors.New("ziptools: malformed record")
+
+// Binary records start with the version of their encoding, legacy JSON records start with '{'.
+// Numbers are little endian, lengths of strings are varints.
+
+// appendUvarint appends a varint.
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+// appendFloat64 appends a float in 8 bytes.
+func appendFloat64(b []byte, v float64) []byte {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(v))
+	return append(b, tmp[:]...)
+}
+
+// recordReader reads the fields of a binary record without allocations,
+// reading past the end sets the error and yields zero values.
+type recordReader struct {
+	b   []byte
+	err error
+}
+
+// version reads the version of the encoding, any other than the given one is an error.
+func (r *recordReader) version(v byte, kind string) {
+	if got := r.byte(); r.err == nil && got != v {
+		r.err = fmt.Errorf("ziptools: unknown version %d of %s record", got, kind)
+	}
+}
+
+func (r *recordReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = ErrMalformedRecord
+		return nil
+	}
+	b := r.b[:n:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *recordReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *recordReader) float64() float64 {
+	if b := r.next(8); b != nil {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *recordReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = ErrMalformedRecord
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *recordReader) float32() float32 {
+	if b := r.next(4); b != nil {
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+// length reads a varint length of bytes that follow in the record.
+func (r *recordReader) length() int {
+	return r.count(1)
+}
+
+// count reads a varint count of items that take at least size bytes each in the rest of the record,
+// larger counts are an error so that corrupt records don't allocate.
+func (r *recordReader) count(size int) int {
+	v := r.uvarint()
+	if v > uint64(len(r.b)/size) {
+		r.err = ErrMalformedRecord
+		return 0
+	}
+	return int(v)
+}
+
+// end checks that the whole record has been read.
+func (r *recordReader) end() error {
+	if r.err == nil && len(r.b) > 0 {
+		r.err = ErrMalformedRecord
+	}
+	return r.err
+}
@@ -1,37 +1,107 @@
 package ziptools
 
 import (
+	"bytes"
+	"math"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools/internal/buckets"
 )
 
 var (
-	citiesBuck     = []byte("cities")
-	locodesBuck    = []byte("locodes")
-	locationsBuck  = []byte("locations")
-	zipsBuck       = []byte("zips")
-	subZipsBuck    = []byte("subzips")
-	subCitiesBuck  = []byte("subcities")
-	subLocodesBuck = []byte("sublocodes")
+	citiesBuck         = buckets.Cities
+	locodesBuck        = buckets.Locodes
+	locationsBuck      = buckets.Locations
+	zipsBuck           = buckets.Zips
+	subZipsBuck        = buckets.SubZips
+	subCitiesBuck      = buckets.SubCities
+	subLocodesBuck     = buckets.SubLocodes
+	locodeCellsBuck    = buckets.LocodeCells
+	zipInfoBuck        = buckets.ZipInfo
+	zipCellsBuck       = buckets.ZipCells
+	boundariesBuck     = buckets.Boundaries
+	boundaryCellsBuck  = buckets.BoundaryCells
+	geohashesBuck      = buckets.Geohashes
+	zipGeohashesBuck   = buckets.ZipGeohashes
+	cityInfoBuck       = buckets.CityInfo
+	postalCodesBuck    = buckets.PostalCodes
+	postalCitiesBuck   = buckets.PostalCities
+	subPostalCodesBuck = buckets.SubPostalCodes
+	countySharesBuck   = buckets.CountyShares
+	cityCasesBuck      = buckets.CityCases
+	metaBuck           = buckets.Meta
 )
 
 // DB abstracts database access.
 type DB struct {
-	db *bolt.DB
+	db     *bolt.DB
+	schema int
+	// index are the options the indexes are built with, writes maintain them alike
+	index IndexOptions
 }
 
-// Open opens a Bolt database from a file if it exists.
+// OpenOptions configure opening a database.
+type OpenOptions struct {
+	// Migrate upgrades databases of earlier schema versions in place, see DB.Migrate.
+	Migrate bool
+}
+
+// Open opens a Bolt database from a file if it exists. A SchemaError is returned
+// if the database is of a later schema version than this package supports.
+// Databases of earlier versions are read as they are.
 func Open(path string) (db *DB, err error) {
+	return OpenWithOptions(path, OpenOptions{})
+}
+
+// OpenWithOptions opens a Bolt database from a file if it exists, like Open does.
+func OpenWithOptions(path string, opts OpenOptions) (db *DB, err error) {
 	if _, err = os.Stat(path); os.IsNotExist(err) {
 		return
 	}
 	db = new(DB)
-	db.db, err = bolt.Open(path, 0644, nil)
+	if db.db, err = bolt.Open(path, 0644, nil); err != nil {
+		return
+	}
+	if err = db.db.View(func(tx *bolt.Tx) error {
+		var err error
+		if db.schema, err = readSchema(tx); err != nil {
+			return err
+		}
+		if db.schema > SchemaVersion {
+			return &SchemaError{Path: path, Version: db.schema}
+		}
+		// databases without a policy index every substring
+		if b := tx.Bucket(metaBuck); b != nil {
+			if v := b.Get(buckets.MetaDataset); v != nil {
+				var meta Metadata
+				if err = meta.Decode(v); err != nil {
+					return err
+				}
+				db.index = meta.Index
+			}
+			if v := b.Get(buckets.MetaSubstrings); v != nil {
+				return db.index.Substrings.Decode(v)
+			}
+		}
+		return nil
+	}); err == nil && opts.Migrate {
+		_, err = db.Migrate(MigrateOptions{})
+	}
+	if err != nil {
+		db.db.Close()
+		db = nil
+	}
 	return
 }
 
+// SubstringPolicy returns the policy the substring index of the database is built with.
+func (d *DB) SubstringPolicy() SubstringPolicy {
+	return d.index.Substrings
+}
+
 func (d *DB) Close() {
 	d.db.Close()
 }
@@ -49,13 +119,147 @@ func (d *DB) GetCity(z Zip) (city string, err error) {
 	return
 }
 
+// GetZipInfo gets the details of the specified zip code.
+// This methods looks for an exact match.
+func (d *DB) GetZipInfo(z Zip) (info *ZipInfo, err error) {
+	info = &ZipInfo{}
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(zipInfoBuck); b != nil {
+			if v := b.Get(z.Bytes()); v != nil {
+				return info.Decode(v)
+			}
+			return nil
+		}
+		return bolt.ErrBucketNotFound
+	})
+	return
+}
+
+// GetBoundary gets the ZCTA boundary of the specified zip code. The boundary is empty
+// if the database has been created without ZCTA boundaries or the zip has none.
+func (d *DB) GetBoundary(z Zip) (boundary Boundary, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(boundariesBuck); b != nil {
+			return d.decodeBoundary(&boundary, b.Get(z.Bytes()))
+		}
+		return nil
+	})
+	return
+}
+
+// decodeBoundary decodes a boundary of the database, boundaries of schema versions before 4 have no version.
+func (d *DB) decodeBoundary(boundary *Boundary, v []byte) error {
+	if d.schema < 4 {
+		return boundary.decodeLegacy(v)
+	}
+	return boundary.Decode(v)
+}
+
+// ZipAt finds a zip code whose ZCTA boundary contains the given point, in that case
+// exact is true. Otherwise the zip code with the nearest centroid is returned.
+func (d *DB) ZipAt(lat, lon float64) (zip Zip, exact bool, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		cells, boundaries := tx.Bucket(boundaryCellsBuck), tx.Bucket(boundariesBuck)
+		if cells != nil && boundaries != nil {
+			prefix := CellOf(lat, lon).Bytes()
+			c := cells.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				var boundary Boundary
+				z := NewZip(string(k[len(prefix):]))
+				if err := d.decodeBoundary(&boundary, boundaries.Get(z.Bytes())); err != nil {
+					return err
+				}
+				if boundary.Contains(lat, lon) {
+					zip, exact = z, true
+					return nil
+				}
+			}
+		}
+		// fall back to the nearest centroid
+		cells, infos := tx.Bucket(zipCellsBuck), tx.Bucket(zipInfoBuck)
+		if cells == nil || infos == nil {
+			return bolt.ErrBucketNotFound
+		}
+		nearest := math.Inf(1)
+		return searchRings(lat, lon, func(cell Cell) error {
+			prefix := cell.Bytes()
+			c := cells.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				var info ZipInfo
+				z := NewZip(string(k[len(prefix):]))
+				if err := info.Decode(infos.Get(z.Bytes())); err != nil {
+					return err
+				}
+				if dist := Distance(lat, lon, info.Latitude, info.Longitude); dist < nearest {
+					zip, nearest = info.Zip, dist
+				}
+			}
+			return nil
+		}, func(bound float64) bool {
+			return nearest <= bound
+		})
+	})
+	return
+}
+
+// GetGeohash gets the geohash of the specified zip code centroid. The precision
+// of geohashes is chosen when the database is created.
+func (d *DB) GetGeohash(z Zip) (hash string, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(zipGeohashesBuck); b != nil {
+			hash = string(b.Get(z.Bytes()))
+			return nil
+		}
+		return bolt.ErrBucketNotFound
+	})
+	return
+}
+
+// FindZipsByGeohashPrefix finds all zip codes whose geohash starts with the given prefix.
+// Prefixes longer than the geohashes of the database find nothing.
+func (d *DB) FindZipsByGeohashPrefix(prefix string) (zips ZipList, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(geohashesBuck); b != nil {
+			p := []byte(strings.ToLower(prefix))
+			c := b.Cursor()
+			for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+				// keys are geohash + zip, the prefix mustn't match zip digits
+				if len(k) < ZipLen || !bytes.HasPrefix(k[:len(k)-ZipLen], p) {
+					continue
+				}
+				zips = append(zips, NewZip(string(k[len(k)-ZipLen:])))
+			}
+			return nil
+		}
+		return bolt.ErrBucketNotFound
+	})
+	return
+}
+
+// GetCountyShares gets the counties of the specified zip code with their shares of addresses,
+// ordered by the total share. The list is empty if the database has been created without
+// the HUD ZIP-COUNTY crosswalk or the crosswalk doesn't cover the zip code.
+func (d *DB) GetCountyShares(z Zip) (shares CountyShareList, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(countySharesBuck); b != nil {
+			if v := b.Get(z.Bytes()); v != nil {
+				return shares.Decode(v)
+			}
+		}
+		return nil
+	})
+	return
+}
+
 // GetLocation gets a location that is assigned to the specified locode.
 // This methods looks for an exact match.
 func (d *DB) GetLocation(l Locode) (loc *Location, err error) {
 	loc = &Location{}
 	err = d.db.View(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(locationsBuck); b != nil {
-			loc.FromBytes(b.Get(l.Bytes()))
+			if v := b.Get(l.Bytes()); v != nil {
+				return loc.Decode(v)
+			}
 			return nil
 		}
 		return bolt.ErrBucketNotFound
@@ -68,7 +272,25 @@ func (d *DB) GetLocation(l Locode) (loc *Location, err error) {
 func (d *DB) GetZips(city string) (zips ZipList, err error) {
 	err = d.db.View(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(citiesBuck); b != nil {
-			zips.FromBytes(b.Get([]byte(city)))
+			return zips.Decode(b.Get([]byte(city)))
+		}
+		return bolt.ErrBucketNotFound
+	})
+	return
+}
+
+// GetCityInfo gets the aggregated details of a city in the specified state.
+// This methods looks for an exact match of the city name, it returns nil if nothing found.
+func (d *DB) GetCityInfo(city, state string) (info *CityInfo, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(cityInfoBuck); b != nil {
+			if v := b.Get(CityInfo{Name: city, State: state}.Key()); v != nil {
+				info = new(CityInfo)
+				if err := info.Decode(v); err != nil {
+					info = nil
+					return err
+				}
+			}
 			return nil
 		}
 		return bolt.ErrBucketNotFound
@@ -81,26 +303,41 @@ func (d *DB) GetZips(city string) (zips ZipList, err error) {
 func (d *DB) GetLocodes(city string) (locodes LocodeList, err error) {
 	err = d.db.View(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(locodesBuck); b != nil {
-			locodes.FromBytes(b.Get([]byte(city)))
-			return nil
+			return locodes.Decode(b.Get([]byte(city)))
 		}
 		return bolt.ErrBucketNotFound
 	})
 	return
 }
 
-// Find all cities that match the given substring.
+// Find all cities that match the given substring. A QueryError is returned
+// if the substring policy of the database can't answer the query. Aliases of
+// cities are found by their own names if the database indexes them.
 func (d *DB) FindCities(citypart string) (cities CityList, err error) {
+	citypart = strings.ToLower(citypart)
+	if err = d.index.Substrings.CheckQuery(citypart); err != nil {
+		return
+	}
 	err = d.db.View(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(subCitiesBuck); b != nil {
 			var list ZipList
-			citypart = strings.ToLower(citypart)
-			list.FromBytes(b.Get([]byte(citypart)))
+			if err := list.Decode(b.Get([]byte(citypart))); err != nil {
+				return err
+			}
+			// a zip code represents names that match, not necessarily its city
+			seen := make(map[string]struct{})
 			for _, zip := range list {
-				if city, err := d.GetCity(zip); err != nil {
+				names, err := d.cityNames(tx, zip)
+				if err != nil {
 					return err
-				} else {
-					cities = append(cities, city)
+				}
+				for _, name := range names {
+					city := strings.ToLower(name)
+					if _, ok := seen[city]; ok || !d.index.Substrings.matches(city, citypart) {
+						continue
+					}
+					seen[city] = struct{}{}
+					cities = append(cities, name)
 				}
 			}
 			return nil
@@ -110,27 +347,206 @@ func (d *DB) FindCities(citypart string) (cities CityList, err error) {
 	return
 }
 
-// Find all locodes by a given substring of a city name.
+// cityNames returns the names the zip code is indexed by, its city and aliases if they are indexed.
+func (d *DB) cityNames(tx *bolt.Tx, zip Zip) ([]string, error) {
+	if !d.index.Aliases {
+		var city string
+		if b := tx.Bucket(zipsBuck); b != nil {
+			city = string(b.Get(zip.Bytes()))
+		}
+		return []string{city}, nil
+	}
+	var info ZipInfo
+	if b := tx.Bucket(zipInfoBuck); b != nil {
+		if err := info.Decode(b.Get(zip.Bytes())); err != nil {
+			return nil, err
+		}
+	}
+	return info.names(true), nil
+}
+
+// Find all locodes by a given substring of a city name. A QueryError is returned
+// if the substring policy of the database can't answer the query.
 func (d *DB) FindLocodes(citypart string) (locodes LocodeList, err error) {
+	citypart = strings.ToLower(citypart)
+	if err = d.index.Substrings.CheckQuery(citypart); err != nil {
+		return
+	}
 	err = d.db.View(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(subLocodesBuck); b != nil {
-			citypart = strings.ToLower(citypart)
-			locodes.FromBytes(b.Get([]byte(citypart)))
-			return nil
+			return locodes.Decode(b.Get([]byte(citypart)))
 		}
 		return bolt.ErrBucketNotFound
 	})
 	return
 }
 
-// Find all zip codes that match the given substring.
+// Find all zip codes that match the given substring. A QueryError is returned
+// if the substring policy of the database can't answer the query.
 func (d *DB) FindZips(zippart string) (zips ZipList, err error) {
+	if err = d.index.Substrings.CheckQuery(zippart); err != nil {
+		return
+	}
 	err = d.db.View(func(tx *bolt.Tx) error {
 		if b := tx.Bucket(subZipsBuck); b != nil {
-			zips.FromBytes(b.Get([]byte(zippart)))
+			return zips.Decode(b.Get([]byte(zippart)))
+		}
+		return bolt.ErrBucketNotFound
+	})
+	return
+}
+
+// NearestLocations finds up to k transport locations that are closest to the given point,
+// ordered by distance. If functions is not zero, only the locations that have all
+// of the specified functions are considered. Locations without coordinates are never found.
+func (d *DB) NearestLocations(lat, lon float64, k int, functions Function) (list NearLocationList, err error) {
+	if k < 1 {
+		return
+	}
+	err = d.db.View(func(tx *bolt.Tx) error {
+		cells := tx.Bucket(locodeCellsBuck)
+		locations := tx.Bucket(locationsBuck)
+		if cells == nil || locations == nil {
+			return bolt.ErrBucketNotFound
+		}
+		return searchRings(lat, lon, func(c Cell) error {
+			var locodes LocodeList
+			if err := locodes.Decode(cells.Get(c.Bytes())); err != nil {
+				return err
+			}
+			for _, locode := range locodes {
+				v := locations.Get(locode.Bytes())
+				fn, locLat, locLon, err := locationPoint(v)
+				if err != nil {
+					return err
+				}
+				if !fn.Has(functions) {
+					continue
+				}
+				// decode the rest of locations that make it to the list only
+				dist := Distance(lat, lon, locLat, locLon)
+				if len(list) == k && list[k-1].Distance <= dist {
+					continue
+				}
+				var loc Location
+				if err = loc.Decode(v); err != nil {
+					return err
+				}
+				list = list.insert(NearLocation{Location: loc, Distance: dist}, k)
+			}
+			return nil
+		}, func(bound float64) bool {
+			return len(list) == k && list[k-1].Distance <= bound
+		})
+	})
+	return
+}
+
+// insert puts a location into the list keeping it ordered and no longer than k.
+func (n NearLocationList) insert(loc NearLocation, k int) NearLocationList {
+	i := sort.Search(len(n), func(i int) bool {
+		return n[i].Distance > loc.Distance
+	})
+	if i >= k {
+		return n
+	}
+	if len(n) < k {
+		n = append(n, NearLocation{})
+	}
+	copy(n[i+1:], n[i:])
+	n[i] = loc
+	return n
+}
+
+// GetPostalCodeInfo gets the details of the specified postal code, it returns nil
+// if nothing found. US postal codes are looked up as zip codes.
+func (d *DB) GetPostalCodeInfo(p PostalCode) (info *PostalCodeInfo, err error) {
+	if p.IsZip() {
+		var zip *ZipInfo
+		if zip, err = d.GetZipInfo(p.Zip()); err != nil || len(zip.City) == 0 {
+			return
+		}
+		info = &PostalCodeInfo{
+			PostalCode: p,
+			City:       zip.City,
+			State:      zip.State,
+			County:     zip.County,
+			Latitude:   zip.Latitude,
+			Longitude:  zip.Longitude,
+		}
+		return
+	}
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(postalCodesBuck); b != nil {
+			if v := b.Get(p.Key()); v != nil {
+				info = new(PostalCodeInfo)
+				if err := info.Decode(v); err != nil {
+					info = nil
+					return err
+				}
+			}
 			return nil
 		}
 		return bolt.ErrBucketNotFound
 	})
 	return
 }
+
+// GetPostalCity gets a city that is assigned to the specified postal code.
+// This methods looks for an exact match.
+func (d *DB) GetPostalCity(p PostalCode) (city string, err error) {
+	if p.IsZip() {
+		return d.GetCity(p.Zip())
+	}
+	info, err := d.GetPostalCodeInfo(p)
+	if info != nil {
+		city = info.City
+	}
+	return
+}
+
+// GetPostalCodes gets a list of postal codes in the specified city of a country.
+// This methods looks for an exact match.
+func (d *DB) GetPostalCodes(country, city string) (codes PostalCodeList, err error) {
+	if country = strings.ToUpper(country); country == CountryUS {
+		zips, err := d.GetZips(city)
+		return zipsToPostalCodes(zips), err
+	}
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(postalCitiesBuck); b != nil {
+			return codes.Decode(b.Get([]byte(country + city)))
+		}
+		return bolt.ErrBucketNotFound
+	})
+	return
+}
+
+// FindPostalCodes finds all postal codes of a country that match the given substring.
+// A QueryError is returned if the substring policy of the database can't answer the query.
+func (d *DB) FindPostalCodes(country, codepart string) (codes PostalCodeList, err error) {
+	part := NewPostalCode(country, codepart)
+	if len(part.Country) == 0 {
+		return
+	}
+	if part.IsZip() {
+		zips, err := d.FindZips(part.Code)
+		return zipsToPostalCodes(zips), err
+	}
+	if err = d.index.Substrings.CheckQuery(part.Code); err != nil {
+		return
+	}
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(subPostalCodesBuck); b != nil {
+			return codes.Decode(b.Get(part.Key()))
+		}
+		return bolt.ErrBucketNotFound
+	})
+	return
+}
+
+func zipsToPostalCodes(zips ZipList) (codes PostalCodeList) {
+	for _, zip := range zips {
+		codes = append(codes, PostalCodeFromZip(zip))
+	}
+	return
+}
@@ -3,9 +3,11 @@ package ziptools
 import (
 	"log"
 	"math/rand"
+	"path/filepath"
 	"strconv"
 	"testing"
 
+	"github.com/boltdb/bolt"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,6 +26,85 @@ func TestGetCity(t *testing.T) {
 	assert.Equal(t, "Syracuse", got)
 }
 
+func TestGetZipInfo(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	exp := &ZipInfo{
+		Zip:       NewZip("13252"),
+		Type:      "UNIQUE",
+		City:      "Syracuse",
+		State:     "NY",
+		County:    "Onondaga County",
+		Timezone:  "America/New_York",
+		Latitude:  43.04,
+		Longitude: -76.14,
+	}
+	got, err := db.GetZipInfo(NewZip("13252"))
+	assert.NoError(t, err)
+	assert.Equal(t, exp, got)
+}
+
+func TestZipAt(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	// the test database has no ZCTA boundaries, so the nearest centroid is used
+	got, exact, err := db.ZipAt(64.84, -147.72)
+	assert.NoError(t, err)
+	assert.False(t, exact)
+	assert.Equal(t, NewZip("99707"), got)
+}
+
+func TestGetGeohash(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	got, err := db.GetGeohash(NewZip("13252"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dr9ug7h", got)
+}
+
+func TestFindZipsByGeohashPrefix(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	got, err := db.FindZipsByGeohashPrefix("DR9UG")
+	assert.NoError(t, err)
+	assert.Len(t, got, 28)
+	assert.Contains(t, got, NewZip("13252"))
+	got, err = db.FindZipsByGeohashPrefix("zzzz")
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+	// longer than the geohashes, the rest of the prefix would be zip digits
+	got, err = db.FindZipsByGeohashPrefix("dr9ug7h13")
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+	got, err = db.FindZipsByGeohashPrefix("dr9ug7h")
+	assert.NoError(t, err)
+	assert.Contains(t, got, NewZip("13252"))
+}
+
+func TestGetCountyShares(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	// the test database has no HUD crosswalk
+	got, err := db.GetCountyShares(NewZip("75080"))
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+}
+
 func TestGetLocation(t *testing.T) {
 	db, err := Open(dbPath)
 	if err != nil {
@@ -31,9 +112,12 @@ func TestGetLocation(t *testing.T) {
 	}
 	defer db.Close()
 	exp := &Location{
-		Name:   "Atlanta",
-		State:  "TX",
-		Locode: NewLocode("TAT"),
+		Name:      "Atlanta",
+		State:     "TX",
+		Locode:    NewLocode("TAT"),
+		Functions: FunctionRoad | FunctionMultimodal,
+		Latitude:  33.1,
+		Longitude: -94.15,
 	}
 	got, err := db.GetLocation(NewLocode("TAT"))
 	assert.NoError(t, err)
@@ -54,6 +138,31 @@ func TestGetZips(t *testing.T) {
 	assert.Equal(t, exp, got)
 }
 
+func TestGetCityInfo(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	got, err := db.GetCityInfo("Richardson", "tx")
+	assert.NoError(t, err)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "Richardson", got.Name)
+		assert.Equal(t, "TX", got.State)
+		assert.Equal(t, ZipList{
+			NewZip("75080"), NewZip("75081"), NewZip("75082"), NewZip("75083"), NewZip("75085"),
+		}, got.Zips)
+		assert.Equal(t, 82338, got.Population)
+		assert.Equal(t, NewZip("75080"), got.PrimaryZip)
+		assert.InDelta(t, 32.97, got.Centroid.Lat, 0.01)
+		assert.InDelta(t, -96.7, got.Centroid.Lon, 0.01)
+		assert.Equal(t, []string{"America/Chicago"}, got.Timezones)
+	}
+	got, err = db.GetCityInfo("Richardson", "NY")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
 func TestGetLocodes(t *testing.T) {
 	db, err := Open(dbPath)
 	if err != nil {
@@ -112,6 +221,92 @@ func TestFindLocodes(t *testing.T) {
 	assert.Equal(t, exp, got)
 }
 
+func TestNearestLocations(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	exp := LocodeList{NewLocode("ZQU"), NewLocode("NNB")}
+	got, err := db.NearestLocations(33.1, -94.15, 2, FunctionRail)
+	assert.NoError(t, err)
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, exp, LocodeList{got[0].Locode, got[1].Locode})
+		assert.InDelta(t, 3.7, got[0].Distance, 0.1)
+		assert.True(t, got[0].Distance <= got[1].Distance)
+	}
+}
+
+func TestPostalCodesUS(t *testing.T) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	city, err := db.GetPostalCity(NewPostalCode("us", "13252"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Syracuse", city)
+	codes, err := db.FindPostalCodes("US", "1337")
+	assert.NoError(t, err)
+	assert.Equal(t, PostalCodeList{
+		NewPostalCode("US", "01337"), NewPostalCode("US", "61337"), NewPostalCode("US", "91337"),
+	}, codes)
+	codes, err = db.GetPostalCodes("US", "Atlantic Beach")
+	assert.NoError(t, err)
+	assert.Len(t, codes, 3)
+	info, err := db.GetPostalCodeInfo(NewPostalCode("US", "13252"))
+	assert.NoError(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, "Onondaga County", info.County)
+	}
+	codes, err = db.FindPostalCodes("CA", "K1A")
+	assert.NoError(t, err)
+	assert.Empty(t, codes)
+}
+
+func TestMalformedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "malformed.db")
+	bdb, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		for _, buck := range [][]byte{zipInfoBuck, citiesBuck, subZipsBuck, locationsBuck, boundariesBuck} {
+			b, err := tx.CreateBucket(buck)
+			if err != nil {
+				return err
+			}
+			// truncated values as left by a failing disk
+			b.Put([]byte("13252"), ZipInfo{Zip: NewZip("13252")}.Bytes()[:10])
+			b.Put([]byte("Syracuse"), ZipList{NewZip("13252")}.Bytes()[:5])
+			b.Put([]byte("132"), ZipList{NewZip("13252")}.Bytes()[:5])
+			b.Put([]byte("SYR"), Location{Locode: NewLocode("SYR")}.Bytes()[:10])
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, bdb.Close())
+
+	db, err := Open(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	_, err = db.GetZipInfo(NewZip("13252"))
+	assert.Equal(t, ErrMalformedRecord, err)
+	_, err = db.GetZips("Syracuse")
+	assert.Equal(t, ErrMalformedRecord, err)
+	_, err = db.FindZips("132")
+	assert.Equal(t, ErrMalformedRecord, err)
+	_, err = db.GetLocation(NewLocode("SYR"))
+	assert.Equal(t, ErrMalformedRecord, err)
+	_, err = db.GetBoundary(NewZip("13252"))
+	assert.Equal(t, ErrMalformedRecord, err)
+	// missing keys aren't errors
+	_, err = db.GetZipInfo(NewZip("10001"))
+	assert.NoError(t, err)
+}
+
 // Benchmarks ===============================================
 
 func BenchmarkGetCity(b *testing.B) {
@@ -223,3 +418,20 @@ func BenchmarkFindLocodes(b *testing.B) {
 		_, _ = db.FindLocodes(cities[i%6])
 	}
 }
+
+func BenchmarkNearestLocations(b *testing.B) {
+	db, err := Open(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+	points := [][2]float64{
+		{40.71, -74.01}, {33.1, -94.15}, {47.61, -122.33},
+		{25.77, -80.19}, {61.22, -149.9}, {39.74, -104.99},
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := points[i%6]
+		_, _ = db.NearestLocations(p[0], p[1], 5, FunctionRail)
+	}
+}
@@ -1,10 +1,10 @@
 package ziptools
 
 import (
-	"bytes"
 	"encoding/binary"
 	"encoding/json"
-	"strconv"
+	"sort"
+	"strings"
 )
 
 const (
@@ -22,23 +22,272 @@ type Locode [LocodeLen]byte
 
 // Location represents transport location.
 type Location struct {
-	Name   string
-	State  string
-	Locode Locode
+	Name      string
+	State     string
+	Locode    Locode
+	Functions Function `json:",omitempty"`
+	Latitude  float64  `json:",omitempty"`
+	Longitude float64  `json:",omitempty"`
 }
 
+// HasCoordinates reports whether the location has known coordinates.
+func (l Location) HasCoordinates() bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
+
+// NearLocation represents a transport location found near a point.
+type NearLocation struct {
+	Location
+	// Distance to the point in kilometers.
+	Distance float64
+}
+
+// NearLocationList represents a list of transport locations ordered by distance.
+type NearLocationList []NearLocation
+
+// locationVersion is the version of the binary encoding of locations.
+const locationVersion = 1
+
 // Bytes returns a serialized version of a location.
+//
+//  [version][locode][functions][latitude][longitude][len(name)][len(state)][name][state]
 func (l Location) Bytes() []byte {
-	b, _ := json.Marshal(l)
-	return b
+	b := make([]byte, 0, 1+LocodeLen+1+16+2*binary.MaxVarintLen16+len(l.Name)+len(l.State))
+	b = append(b, locationVersion)
+	b = append(b, l.Locode[:]...)
+	b = append(b, byte(l.Functions))
+	b = appendFloat64(b, l.Latitude)
+	b = appendFloat64(b, l.Longitude)
+	b = appendUvarint(b, uint64(len(l.Name)))
+	b = appendUvarint(b, uint64(len(l.State)))
+	b = append(b, l.Name...)
+	return append(b, l.State...)
 }
 
-// FromBytes constructs a new location from bytes.
+// FromBytes constructs a new location from bytes. Malformed data yields an empty location.
 func (l *Location) FromBytes(b []byte) *Location {
-	json.Unmarshal(b, l)
+	if l.Decode(b) != nil {
+		*l = Location{}
+	}
 	return l
 }
 
+// Decode decodes a location from bytes of the binary or the legacy JSON encoding.
+// The name and the state share a single allocation.
+func (l *Location) Decode(b []byte) error {
+	if len(b) > 0 && b[0] == '{' {
+		*l = Location{}
+		if json.Unmarshal(b, l) != nil {
+			return ErrMalformedRecord
+		}
+		return nil
+	}
+	r := recordReader{b: b}
+	r.version(locationVersion, "location")
+	copy(l.Locode[:], r.next(LocodeLen))
+	l.Functions = Function(r.byte())
+	l.Latitude = r.float64()
+	l.Longitude = r.float64()
+	nameLen := r.length()
+	stateLen := r.length()
+	str := string(r.next(nameLen + stateLen))
+	if err := r.end(); err != nil {
+		return err
+	}
+	l.Name, l.State = str[:nameLen], str[nameLen:]
+	return nil
+}
+
+// locationPoint decodes the functions and the coordinates of a location without allocations.
+func locationPoint(b []byte) (functions Function, lat, lon float64, err error) {
+	if len(b) > 0 && b[0] == '{' {
+		var l Location
+		err = l.Decode(b)
+		return l.Functions, l.Latitude, l.Longitude, err
+	}
+	r := recordReader{b: b}
+	r.version(locationVersion, "location")
+	r.next(LocodeLen)
+	functions = Function(r.byte())
+	lat = r.float64()
+	lon = r.float64()
+	return functions, lat, lon, r.err
+}
+
+// ZipInfo represents the details of a zip code.
+type ZipInfo struct {
+	Zip        Zip
+	Type       string
+	City       string
+	State      string
+	County     string  `json:",omitempty"`
+	Timezone   string  `json:",omitempty"`
+	Latitude   float64 `json:",omitempty"`
+	Longitude  float64 `json:",omitempty"`
+	Population int     `json:",omitempty"`
+	// Aliases are other acceptable city names of the zip code.
+	Aliases []string `json:",omitempty"`
+	// LandArea and WaterArea of the zip code tabulation area in square meters.
+	LandArea  int64 `json:",omitempty"`
+	WaterArea int64 `json:",omitempty"`
+}
+
+// HasCoordinates reports whether the zip code has known coordinates.
+func (z ZipInfo) HasCoordinates() bool {
+	return z.Latitude != 0 || z.Longitude != 0
+}
+
+// names returns the names the zip code is indexed by in cities, its city and its aliases if they are indexed.
+func (z ZipInfo) names(aliases bool) (names []string) {
+	if len(z.City) > 0 {
+		names = append(names, z.City)
+	}
+	if !aliases {
+		return
+	}
+	for _, alias := range z.Aliases {
+		if len(alias) > 0 && !containsString(names, alias) {
+			names = append(names, alias)
+		}
+	}
+	return
+}
+
+// Bytes returns a serialized version of a zip info.
+func (z ZipInfo) Bytes() []byte {
+	b, _ := json.Marshal(z)
+	return b
+}
+
+// FromBytes constructs a new zip info from bytes. Malformed data yields an empty zip info.
+func (z *ZipInfo) FromBytes(b []byte) *ZipInfo {
+	z.Decode(b)
+	return z
+}
+
+// Decode decodes a zip info from bytes, the zip info is empty on errors.
+func (z *ZipInfo) Decode(b []byte) error {
+	*z = ZipInfo{}
+	if json.Unmarshal(b, z) != nil {
+		*z = ZipInfo{}
+		return ErrMalformedRecord
+	}
+	return nil
+}
+
+// CityInfo represents the aggregated details of a city.
+type CityInfo struct {
+	Name       string
+	State      string
+	Zips       ZipList
+	Population int
+	// Centroid is the population weighted center of the city's zip codes.
+	Centroid Point
+	// PrimaryZip is the most populated zip code of the city.
+	PrimaryZip Zip
+	Timezones  []string
+}
+
+// NewCityInfo aggregates the details of the zip codes of a city, the name and the state are
+// the ones of the first zip code. The centroid is weighted by the population of zip codes,
+// the most populated zip code is the primary one.
+func NewCityInfo(zips []ZipInfo) (city CityInfo) {
+	if len(zips) == 0 {
+		return
+	}
+	city = CityInfo{Name: zips[0].City, State: zips[0].State}
+	var lat, lon, weight float64
+	primary := -1
+	timezones := make(map[string]struct{})
+	for _, zip := range zips {
+		city.Zips = append(city.Zips, zip.Zip)
+		city.Population += zip.Population
+		if zip.Population > primary {
+			city.PrimaryZip, primary = zip.Zip, zip.Population
+		}
+		if len(zip.Timezone) > 0 {
+			timezones[zip.Timezone] = struct{}{}
+		}
+		if zip.HasCoordinates() {
+			// zips without population still count for unpopulated cities
+			w := float64(zip.Population) + 1e-6
+			lat += zip.Latitude * w
+			lon += zip.Longitude * w
+			weight += w
+		}
+	}
+	if weight > 0 {
+		city.Centroid = Point{Lat: lat / weight, Lon: lon / weight}
+	}
+	for tz := range timezones {
+		city.Timezones = append(city.Timezones, tz)
+	}
+	sort.Strings(city.Timezones)
+	return
+}
+
+// Key returns a key of the city that is unique across states.
+func (c CityInfo) Key() []byte {
+	return []byte(strings.ToUpper(c.State) + "/" + c.Name)
+}
+
+// Bytes returns a serialized version of a city info.
+func (c CityInfo) Bytes() []byte {
+	b, _ := json.Marshal(c)
+	return b
+}
+
+// FromBytes constructs a new city info from bytes. Malformed data yields an empty city info.
+func (c *CityInfo) FromBytes(b []byte) *CityInfo {
+	c.Decode(b)
+	return c
+}
+
+// Decode decodes a city info from bytes, the city info is empty on errors.
+func (c *CityInfo) Decode(b []byte) error {
+	*c = CityInfo{}
+	if json.Unmarshal(b, c) != nil {
+		*c = CityInfo{}
+		return ErrMalformedRecord
+	}
+	return nil
+}
+
+// CountyShare represents the share of a zip code's addresses that lie within a county.
+type CountyShare struct {
+	// County is a 5-digit FIPS county code.
+	County      string
+	Residential float64
+	Business    float64
+	Other       float64
+	Total       float64
+}
+
+// CountyShareList represents the counties of a zip code ordered by the total share.
+type CountyShareList []CountyShare
+
+// Bytes returns a serialized version of a county share list.
+func (c CountyShareList) Bytes() []byte {
+	b, _ := json.Marshal(c)
+	return b
+}
+
+// FromBytes constructs a new county share list from bytes. Malformed data yields an empty county share list.
+func (c *CountyShareList) FromBytes(b []byte) CountyShareList {
+	c.Decode(b)
+	return *c
+}
+
+// Decode decodes a county share list from bytes, the county share list is empty on errors.
+func (c *CountyShareList) Decode(b []byte) error {
+	*c = nil
+	if json.Unmarshal(b, c) != nil {
+		*c = nil
+		return ErrMalformedRecord
+	}
+	return nil
+}
+
 // NewZip creates a new zip code from string.
 func NewZip(str string) (zip Zip) {
 	for i, c := range []byte(str) {
@@ -73,13 +322,13 @@ func (l Locode) String() string {
 
 // MarshalJSON represents a zip as a string while marshaling as JSON.
 func (z Zip) MarshalJSON() ([]byte, error) {
-	return []byte(strconv.Quote(z.String())), nil
+	return json.Marshal(z.String())
 }
 
 // UnmarshalJSON restores zip code from bytes after marshaling as JSON.
 func (z *Zip) UnmarshalJSON(b []byte) (err error) {
-	str := string(b)
-	if str, err = strconv.Unquote(str); err != nil {
+	var str string
+	if err = json.Unmarshal(b, &str); err != nil {
 		return err
 	}
 	*z = NewZip(str)
@@ -88,13 +337,13 @@ func (z *Zip) UnmarshalJSON(b []byte) (err error) {
 
 // MarshalJSON represents a locode as a string while marshaling as JSON.
 func (l Locode) MarshalJSON() ([]byte, error) {
-	return []byte(strconv.Quote(l.String())), nil
+	return json.Marshal(l.String())
 }
 
 // UnmarshalJSON restores locode from bytes after marshaling as JSON.
 func (l *Locode) UnmarshalJSON(b []byte) (err error) {
-	str := string(b)
-	if str, err = strconv.Unquote(str); err != nil {
+	var str string
+	if err = json.Unmarshal(b, &str); err != nil {
 		return err
 	}
 	*l = NewLocode(str)
@@ -167,46 +416,103 @@ func (c CityList) Range(offset, limit int) CityList {
 	return c[offset : offset+limit]
 }
 
-// Bytes returns a serialized version of a zip list. First byte represents the length.
+// listVersion is the version of the encoding of zip and locode lists. A versioned list starts
+// with a zero byte, the version and the varint length. Legacy lists start with a length byte
+// that wraps around at 256 entries, their length is restored from the size of the data.
+const listVersion = 1
+
+// Bytes returns a serialized version of a zip list, the length is a varint.
 //
-//  [N][zip1][zip2]...[zipN]
+//  [0x00][version][N][zip1][zip2]...[zipN]
 func (z ZipList) Bytes() []byte {
-	var buf bytes.Buffer
-	buf.WriteByte(byte(len(z)))
-	binary.Write(&buf, binary.LittleEndian, z)
-	return buf.Bytes()
+	b := appendListHeader(make([]byte, 0, 2+binary.MaxVarintLen64+len(z)*ZipLen), len(z))
+	for _, zip := range z {
+		b = append(b, zip[:]...)
+	}
+	return b
 }
 
-// Bytes returns a serialized version of a locode list. First byte represents the length.
+// Bytes returns a serialized version of a locode list, the length is a varint.
 //
-//  [N][locode1][locode2]...[locodeN]
+//  [0x00][version][N][locode1][locode2]...[locodeN]
 func (l LocodeList) Bytes() []byte {
-	var buf bytes.Buffer
-	buf.WriteByte(byte(len(l)))
-	binary.Write(&buf, binary.LittleEndian, l)
-	return buf.Bytes()
+	b := appendListHeader(make([]byte, 0, 2+binary.MaxVarintLen64+len(l)*LocodeLen), len(l))
+	for _, locode := range l {
+		b = append(b, locode[:]...)
+	}
+	return b
 }
 
-// FromBytes constructs a new zip list from bytes. First byte reperesents the length.
+// FromBytes constructs a new zip list from bytes of both the versioned and the legacy encoding.
+// Malformed data yields an empty list.
 func (z *ZipList) FromBytes(b []byte) ZipList {
-	r := bytes.NewReader(b)
-	if n, err := r.ReadByte(); err != nil {
-		return nil
-	} else {
-		*z = make(ZipList, n)
-	}
-	binary.Read(r, binary.LittleEndian, z)
+	z.Decode(b)
 	return *z
 }
 
-// FromBytes constructs a new locode from bytes. First byte reperesents the length.
-func (l *LocodeList) FromBytes(b []byte) LocodeList {
-	r := bytes.NewReader(b)
-	if n, err := r.ReadByte(); err != nil {
-		return nil
-	} else {
-		*l = make(LocodeList, n)
+// Decode decodes a zip list from bytes of both the versioned and the legacy encoding,
+// the list is nil on errors and for empty bytes.
+func (z *ZipList) Decode(b []byte) error {
+	*z = nil
+	n, items, err := listItems(b, ZipLen)
+	if err != nil || n < 0 {
+		return err
+	}
+	*z = make(ZipList, n)
+	for i := range *z {
+		copy((*z)[i][:], items[i*ZipLen:])
 	}
-	binary.Read(r, binary.LittleEndian, l)
+	return nil
+}
+
+// FromBytes constructs a new locode list from bytes of both the versioned and the legacy encoding.
+// Malformed data yields an empty list.
+func (l *LocodeList) FromBytes(b []byte) LocodeList {
+	l.Decode(b)
 	return *l
 }
+
+// Decode decodes a locode list from bytes of both the versioned and the legacy encoding,
+// the list is nil on errors and for empty bytes.
+func (l *LocodeList) Decode(b []byte) error {
+	*l = nil
+	n, items, err := listItems(b, LocodeLen)
+	if err != nil || n < 0 {
+		return err
+	}
+	*l = make(LocodeList, n)
+	for i := range *l {
+		copy((*l)[i][:], items[i*LocodeLen:])
+	}
+	return nil
+}
+
+// appendListHeader appends the header of a versioned list of n entries.
+func appendListHeader(b []byte, n int) []byte {
+	b = append(b, 0, listVersion)
+	return appendUvarint(b, uint64(n))
+}
+
+// listItems returns the number of entries of the size in an encoded list and the bytes of the entries,
+// n is -1 if there's no list. The size of the data must match the length exactly.
+func listItems(b []byte, size int) (n int, items []byte, err error) {
+	if len(b) == 0 {
+		return -1, nil, nil
+	}
+	// the second byte of legacy lists is a part of a printable entry, not a version
+	if len(b) > 1 && b[0] == 0 && b[1] < ' ' {
+		r := recordReader{b: b[1:]}
+		r.version(listVersion, "list")
+		n = r.count(size)
+		if r.err == nil && n*size != len(r.b) {
+			r.err = ErrMalformedRecord
+		}
+		return n, r.b, r.err
+	}
+	// the length byte of legacy lists wraps around at 256 entries
+	items = b[1:]
+	if n = len(items) / size; len(items)%size != 0 || n%256 != int(b[0]) {
+		return 0, nil, ErrMalformedRecord
+	}
+	return n, items, nil
+}
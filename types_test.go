@@ -2,6 +2,9 @@ package ziptools
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -28,17 +31,70 @@ func TestZipListBytes(t *testing.T) {
 	list := ZipList{
 		NewZip("11111"), NewZip("22222"), NewZip("3"),
 	}
-	exp := []byte("\x0311111222223\x00\x00\x00\x00")
+	exp := []byte("\x00\x01\x0311111222223\x00\x00\x00\x00")
 	assert.Equal(t, exp, list.Bytes())
 }
 
 func TestZipListFromBytes(t *testing.T) {
-	data := []byte("\x0311111222223\x00\x00\x00\x00")
+	data := []byte("\x00\x01\x0311111222223\x00\x00\x00\x00")
 	exp := ZipList{
 		NewZip("11111"), NewZip("22222"), NewZip("3"),
 	}
 	var list ZipList
 	assert.Equal(t, exp, list.FromBytes(data))
+	// legacy encoding
+	data = []byte("\x0311111222223\x00\x00\x00\x00")
+	assert.Equal(t, exp, list.FromBytes(data))
+	assert.Nil(t, list.FromBytes(nil))
+}
+
+func TestZipListBytesLong(t *testing.T) {
+	list := make(ZipList, 1000)
+	for i := range list {
+		list[i] = NewZip(fmt.Sprintf("%05d", i))
+	}
+	data := list.Bytes()
+	assert.Equal(t, []byte{0x00, 0x01, 0xe8, 0x07}, data[:4])
+	var got ZipList
+	assert.Equal(t, list, got.FromBytes(data))
+	assert.Equal(t, ZipList{}, got.FromBytes(ZipList{}.Bytes()))
+	// legacy lists of more than 255 entries have a wrapped length byte
+	legacy := append([]byte{byte(len(list))}, data[4:]...)
+	assert.Equal(t, list, got.FromBytes(legacy))
+}
+
+func TestZipListDecode(t *testing.T) {
+	var list ZipList
+	assert.NoError(t, list.Decode(nil))
+	assert.Nil(t, list)
+	for _, data := range []string{
+		"\x00\x01\x0311111222223\x00\x00\x00",         // truncated
+		"\x00\x01\x0311111222223\x00\x00\x00\x00\x00", // trailing bytes
+		"\x00\x01\xff\xff\xff\xff\x0f11111",           // oversized length
+		"\x00\x01",                                    // no length
+		"\x0311111222223\x00\x00",                     // legacy truncated
+		"\x0211111222223\x00\x00\x00\x00",             // legacy length mismatch
+	} {
+		assert.Equal(t, ErrMalformedRecord, list.Decode([]byte(data)), "%q", data)
+		assert.Nil(t, list)
+	}
+	assert.EqualError(t, list.Decode([]byte("\x00\x02\x00")), "ziptools: unknown version 2 of list record")
+}
+
+func FuzzZipList(f *testing.F) {
+	f.Add(ZipList{NewZip("11111"), NewZip("22222"), NewZip("3")}.Bytes())
+	f.Add([]byte("\x0311111222223\x00\x00\x00\x00"))
+	f.Add([]byte("\x00\x01\xff\xff\xff\xff\x0f11111"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var list ZipList
+		if list.Decode(data) != nil {
+			assert.Nil(t, list)
+			return
+		}
+		var got ZipList
+		assert.NoError(t, got.Decode(list.Bytes()))
+		assert.Equal(t, list.Bytes(), got.Bytes())
+	})
 }
 
 func TestZipListRange(t *testing.T) {
@@ -76,17 +132,56 @@ func TestLocodeListBytes(t *testing.T) {
 	list := LocodeList{
 		NewLocode("ABD"), NewLocode("ABJ"), NewLocode("AQ"),
 	}
-	exp := []byte("\x03ABDABJAQ\x00")
+	exp := []byte("\x00\x01\x03ABDABJAQ\x00")
 	assert.Equal(t, exp, list.Bytes())
 }
 
 func TestLocodeListFromBytes(t *testing.T) {
-	data := []byte("\x03ABDABJAQ\x00")
+	data := []byte("\x00\x01\x03ABDABJAQ\x00")
 	exp := LocodeList{
 		NewLocode("ABD"), NewLocode("ABJ"), NewLocode("AQ"),
 	}
 	var list LocodeList
 	assert.Equal(t, exp, list.FromBytes(data))
+	// legacy encoding
+	data = []byte("\x03ABDABJAQ\x00")
+	assert.Equal(t, exp, list.FromBytes(data))
+}
+
+func TestLocodeListBytesLong(t *testing.T) {
+	list := make(LocodeList, 300)
+	for i := range list {
+		list[i] = NewLocode(fmt.Sprintf("%03d", i))
+	}
+	var got LocodeList
+	assert.Equal(t, list, got.FromBytes(list.Bytes()))
+}
+
+func TestLocodeListDecode(t *testing.T) {
+	var list LocodeList
+	for _, data := range []string{
+		"\x00\x01\x03ABDABJAQ",    // truncated
+		"\x00\x01\xff\xff\x03ABD", // oversized length
+		"\x03ABDABJAQ",            // legacy truncated
+	} {
+		assert.Equal(t, ErrMalformedRecord, list.Decode([]byte(data)), "%q", data)
+		assert.Nil(t, list)
+	}
+}
+
+func FuzzLocodeList(f *testing.F) {
+	f.Add(LocodeList{NewLocode("ABD"), NewLocode("ABJ"), NewLocode("AQ")}.Bytes())
+	f.Add([]byte("\x03ABDABJAQ\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var list LocodeList
+		if list.Decode(data) != nil {
+			assert.Nil(t, list)
+			return
+		}
+		var got LocodeList
+		assert.NoError(t, got.Decode(list.Bytes()))
+		assert.Equal(t, list.Bytes(), got.Bytes())
+	})
 }
 
 func TestLocodeListRange(t *testing.T) {
@@ -109,7 +204,7 @@ func TestLocationBytes(t *testing.T) {
 		State:  "AL",
 		Locode: NewLocode("ABB"),
 	}
-	exp := []byte("{\"Name\":\"Abbeville\",\"State\":\"AL\",\"Locode\":\"ABB\"}")
+	exp := []byte("\x01ABB\x00" + strings.Repeat("\x00", 16) + "\x09\x02AbbevilleAL")
 	assert.Equal(t, exp, data.Bytes())
 }
 
@@ -122,4 +217,128 @@ func TestLocationFromBytes(t *testing.T) {
 	}
 	var loc Location
 	assert.Equal(t, exp, loc.FromBytes(data))
+	exp.Functions = FunctionRoad | FunctionAirport
+	exp.Latitude, exp.Longitude = 31.57, -85.25
+	assert.Equal(t, exp, loc.FromBytes(exp.Bytes()))
+}
+
+func TestLocationDecode(t *testing.T) {
+	data := Location{Name: "Abbeville", State: "AL", Locode: NewLocode("ABB")}.Bytes()
+	var loc Location
+	assert.NoError(t, loc.Decode(data))
+	assert.Equal(t, ErrMalformedRecord, loc.Decode(data[:len(data)-1]))
+	assert.Equal(t, ErrMalformedRecord, loc.Decode(append(data, 0)))
+	assert.Equal(t, ErrMalformedRecord, loc.Decode(nil))
+	assert.Equal(t, ErrMalformedRecord, loc.Decode([]byte("{\"Name\":")))
+	assert.Error(t, loc.Decode(append([]byte{2}, data[1:]...)))
+	assert.Equal(t, &Location{}, loc.FromBytes(data[:10]))
+}
+
+func TestLocationPoint(t *testing.T) {
+	data := Location{Locode: NewLocode("ABB"), Functions: FunctionAirport, Latitude: 31.57, Longitude: -85.25}.Bytes()
+	var fn Function
+	var lat, lon float64
+	allocs := testing.AllocsPerRun(10, func() {
+		fn, lat, lon, _ = locationPoint(data)
+	})
+	assert.Equal(t, FunctionAirport, fn)
+	assert.Equal(t, 31.57, lat)
+	assert.Equal(t, -85.25, lon)
+	assert.Zero(t, allocs)
+}
+
+func FuzzLocation(f *testing.F) {
+	f.Add(Location{Name: "Abbeville", State: "AL", Locode: NewLocode("ABB"), Latitude: 31.57, Longitude: -85.25}.Bytes())
+	f.Add([]byte("{\"Name\":\"Abbeville\",\"State\":\"AL\",\"Locode\":\"ABB\"}"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var loc Location
+		err := loc.Decode(data)
+		fn, lat, lon, pointErr := locationPoint(data)
+		if err != nil {
+			return
+		}
+		// the point is decoded from the head of a valid record
+		assert.NoError(t, pointErr)
+		assert.Equal(t, loc.Functions, fn)
+		assert.Equal(t, math.Float64bits(loc.Latitude), math.Float64bits(lat))
+		assert.Equal(t, math.Float64bits(loc.Longitude), math.Float64bits(lon))
+		var got Location
+		assert.NoError(t, got.Decode(loc.Bytes()))
+		assert.Equal(t, loc.Bytes(), got.Bytes())
+	})
+}
+
+func BenchmarkLocationDecode(b *testing.B) {
+	data := Location{Name: "Abbeville", State: "AL", Locode: NewLocode("ABB"), Latitude: 31.57, Longitude: -85.25}.Bytes()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var loc Location
+		loc.Decode(data)
+	}
+}
+
+// ==================
+
+func TestCountyShareListBytes(t *testing.T) {
+	data := CountyShareList{
+		{County: "48113", Residential: 0.9, Business: 0.8, Other: 0.7, Total: 0.85},
+		{County: "48085", Residential: 0.1, Business: 0.2, Other: 0.3, Total: 0.15},
+	}
+	var list CountyShareList
+	assert.Equal(t, data, list.FromBytes(data.Bytes()))
+}
+
+func TestZipInfoDecode(t *testing.T) {
+	info := ZipInfo{Zip: NewZip("13252"), City: "Syracuse", State: "NY", Aliases: []string{"Salina"}}
+	var got ZipInfo
+	assert.NoError(t, got.Decode(info.Bytes()))
+	assert.Equal(t, info, got)
+	data := info.Bytes()
+	assert.Equal(t, ErrMalformedRecord, got.Decode(data[:len(data)-1]))
+	assert.Equal(t, ZipInfo{}, got)
+	assert.Equal(t, ErrMalformedRecord, got.Decode(nil))
+}
+
+func FuzzZipInfo(f *testing.F) {
+	f.Add(ZipInfo{Zip: NewZip("13252"), City: "Syracuse", State: "NY", Latitude: 43.04, Aliases: []string{"Salina"}}.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var info ZipInfo
+		if info.Decode(data) != nil {
+			assert.Equal(t, ZipInfo{}, info)
+			return
+		}
+		var got ZipInfo
+		assert.NoError(t, got.Decode(info.Bytes()))
+		assert.Equal(t, info.Bytes(), got.Bytes())
+	})
+}
+
+func FuzzCityInfo(f *testing.F) {
+	f.Add(CityInfo{Name: "Syracuse", State: "NY", Zips: ZipList{NewZip("13252")}, Timezones: []string{"America/New_York"}}.Bytes())
+	// zips that aren't valid UTF-8 used to be quoted into invalid JSON
+	f.Add([]byte("{\"Zips\":[\"000\x920\"]}"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var info CityInfo
+		if info.Decode(data) != nil {
+			assert.Equal(t, CityInfo{}, info)
+			return
+		}
+		var got CityInfo
+		assert.NoError(t, got.Decode(info.Bytes()))
+		assert.Equal(t, info.Bytes(), got.Bytes())
+	})
+}
+
+func FuzzCountyShareList(f *testing.F) {
+	f.Add(CountyShareList{{County: "48113", Residential: 0.9, Total: 0.85}}.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var list CountyShareList
+		if list.Decode(data) != nil {
+			assert.Nil(t, list)
+			return
+		}
+		var got CountyShareList
+		assert.NoError(t, got.Decode(list.Bytes()))
+		assert.Equal(t, list.Bytes(), got.Bytes())
+	})
 }
@@ -0,0 +1,718 @@
+package ziptools
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/xlab/ziptools/internal/buckets"
+)
+
+var (
+	errNoZip    = errors.New("ziptools: zip code info has no zip code or city")
+	errNoLocode = errors.New("ziptools: location has no locode or name")
+	errSchema   = errors.New("ziptools: the database must be migrated to the current schema version before it's changed, see DB.Migrate")
+)
+
+// PutZip puts the zip code info into the database, replacing the previous info of the zip code.
+// The cities, the substring indexes, the spatial indexes and the aggregated details of the cities
+// of both infos are updated in the same transaction.
+func (d *DB) PutZip(info ZipInfo) error {
+	if info.Zip == (Zip{}) || len(info.City) == 0 {
+		return errNoZip
+	}
+	return d.update(func(w *writer) error {
+		return w.putZip(info)
+	})
+}
+
+// DeleteZip deletes the zip code along with its county shares and its boundary,
+// and removes it from every index. Deleting a missing zip code does nothing.
+func (d *DB) DeleteZip(z Zip) error {
+	return d.update(func(w *writer) error {
+		return w.deleteZip(z)
+	})
+}
+
+// PutLocation puts the location into the database, replacing the previous location of the locode.
+// The cities, the substring index and the spatial index of locodes are updated in the same transaction.
+func (d *DB) PutLocation(loc Location) error {
+	if loc.Locode == (Locode{}) || len(loc.Name) == 0 {
+		return errNoLocode
+	}
+	return d.update(func(w *writer) error {
+		return w.putLocation(loc)
+	})
+}
+
+// DeleteLocation deletes the location and removes its locode from every index.
+// Deleting a missing location does nothing.
+func (d *DB) DeleteLocation(l Locode) error {
+	return d.update(func(w *writer) error {
+		return w.deleteLocation(l)
+	})
+}
+
+// update runs fn in a writing transaction of a database of the current schema version, aggregates the cities it changes and records the time of the change.
+func (d *DB) update(fn func(w *writer) error) error {
+	// indexes of earlier versions aren't maintained
+	if d.schema < SchemaVersion {
+		return errSchema
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		w := &writer{tx: tx, index: d.index, cities: make(map[string]CityInfo)}
+		// geohashes of the zip code being replaced may be the only ones to tell the precision
+		w.index.GeohashPrecision = w.geohashPrecision()
+		if err := fn(w); err != nil {
+			return err
+		}
+		if err := w.aggregateCities(); err != nil {
+			return err
+		}
+		return w.touch()
+	})
+}
+
+// writer maintains the indexes the way the importer builds them. Substring lists truncated
+// by the substring policy aren't refilled when entries are removed.
+type writer struct {
+	tx    *bolt.Tx
+	index IndexOptions
+	// cities to aggregate by their keys
+	cities map[string]CityInfo
+}
+
+func (w *writer) bucket(name []byte) (*bolt.Bucket, error) {
+	return w.tx.CreateBucketIfNotExists(name)
+}
+
+// zipInfo gets the info of the zip code if it's in the database.
+func (w *writer) zipInfo(zip Zip) (info ZipInfo, ok bool, err error) {
+	b := w.tx.Bucket(zipInfoBuck)
+	if b == nil {
+		return
+	}
+	v := b.Get(zip.Bytes())
+	if v == nil {
+		return
+	}
+	return info, true, info.Decode(v)
+}
+
+func (w *writer) putZip(info ZipInfo) error {
+	zip := info.Zip
+	prev, ok, err := w.zipInfo(zip)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if err = w.unindexZip(prev); err != nil {
+			return err
+		}
+		w.changeCity(prev)
+	} else {
+		// subzips -> ziplist
+		if err = w.addSubstrings(subZipsBuck, string(zip.Bytes()), zip); err != nil {
+			return err
+		}
+	}
+	w.changeCity(info)
+	if err = w.putBytes(zipsBuck, zip.Bytes(), []byte(info.City)); err != nil {
+		return err
+	}
+	if err = w.putBytes(zipInfoBuck, zip.Bytes(), info.Bytes()); err != nil {
+		return err
+	}
+	if err = w.indexZip(info); err != nil {
+		return err
+	}
+	// full city names -> ziplist
+	prevNames := w.cityNames(prev)
+	names := w.cityNames(info)
+	for _, name := range prevNames {
+		if !containsString(names, name) {
+			if err = w.updateCity(name, zip, false); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range names {
+		if !containsString(prevNames, name) {
+			if err = w.updateCity(name, zip, true); err != nil {
+				return err
+			}
+		}
+	}
+	// subcities -> ziplist
+	prevCities, cities := lowerNames(prevNames), lowerNames(names)
+	for _, city := range prevCities {
+		if !containsString(cities, city) {
+			if err = w.representCity(city, zip, true); err != nil {
+				return err
+			}
+		}
+	}
+	for _, city := range cities {
+		if !containsString(prevCities, city) {
+			if err = w.representCity(city, zip, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *writer) deleteZip(zip Zip) error {
+	prev, ok, err := w.zipInfo(zip)
+	if err != nil || !ok {
+		return err
+	}
+	w.changeCity(prev)
+	if err = w.unindexZip(prev); err != nil {
+		return err
+	}
+	names := w.cityNames(prev)
+	for _, name := range names {
+		if err = w.updateCity(name, zip, false); err != nil {
+			return err
+		}
+	}
+	for _, city := range lowerNames(names) {
+		if err = w.representCity(city, zip, true); err != nil {
+			return err
+		}
+	}
+	if err = w.removeSubstrings(subZipsBuck, string(zip.Bytes()), zip); err != nil {
+		return err
+	}
+	if err = w.deleteBoundary(zip); err != nil {
+		return err
+	}
+	for _, name := range [][]byte{zipsBuck, zipInfoBuck, countySharesBuck} {
+		if b := w.tx.Bucket(name); b != nil {
+			if err = b.Delete(zip.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// changeCity marks the city of the zip code to be aggregated.
+func (w *writer) changeCity(info ZipInfo) {
+	city := CityInfo{Name: info.City, State: info.State}
+	w.cities[string(city.Key())] = city
+}
+
+// cityNames returns the names the zip code is listed by in cities.
+func (w *writer) cityNames(info ZipInfo) []string {
+	return info.names(w.index.Aliases)
+}
+
+// indexZip indexes the coordinates of the zip code by grid cells and geohashes.
+func (w *writer) indexZip(info ZipInfo) error {
+	if !info.HasCoordinates() {
+		return nil
+	}
+	zip := info.Zip
+	// grid cell + zip
+	cell := CellOf(info.Latitude, info.Longitude)
+	if err := w.putBytes(zipCellsBuck, cell.Key(zip), []byte{}); err != nil {
+		return err
+	}
+	if w.index.GeohashPrecision == 0 {
+		return nil
+	}
+	hash := Geohash(info.Latitude, info.Longitude, w.index.GeohashPrecision)
+	// zip = geohash
+	if err := w.putBytes(zipGeohashesBuck, zip.Bytes(), []byte(hash)); err != nil {
+		return err
+	}
+	// geohash + zip
+	return w.putBytes(geohashesBuck, append([]byte(hash), zip[:]...), []byte{})
+}
+
+// unindexZip removes the coordinates of the zip code from the indexes.
+func (w *writer) unindexZip(info ZipInfo) error {
+	zip := info.Zip
+	if b := w.tx.Bucket(zipCellsBuck); b != nil && info.HasCoordinates() {
+		if err := b.Delete(CellOf(info.Latitude, info.Longitude).Key(zip)); err != nil {
+			return err
+		}
+	}
+	zipGeohashes := w.tx.Bucket(zipGeohashesBuck)
+	if zipGeohashes == nil {
+		return nil
+	}
+	if hash := zipGeohashes.Get(zip.Bytes()); hash != nil {
+		if b := w.tx.Bucket(geohashesBuck); b != nil {
+			if err := b.Delete(append(append([]byte{}, hash...), zip[:]...)); err != nil {
+				return err
+			}
+		}
+		return zipGeohashes.Delete(zip.Bytes())
+	}
+	return nil
+}
+
+// geohashPrecision returns the precision of geohashes of the database, zero if it's unknown.
+func (w *writer) geohashPrecision() int {
+	if w.index.GeohashPrecision > 0 {
+		return w.index.GeohashPrecision
+	}
+	// databases without metadata have geohashes of the precision
+	if b := w.tx.Bucket(zipGeohashesBuck); b != nil {
+		if _, v := b.Cursor().First(); v != nil {
+			return len(v)
+		}
+	}
+	return 0
+}
+
+// deleteBoundary deletes the boundary of the zip code and its grid cells.
+func (w *writer) deleteBoundary(zip Zip) error {
+	b := w.tx.Bucket(boundariesBuck)
+	if b == nil {
+		return nil
+	}
+	var boundary Boundary
+	if err := boundary.Decode(b.Get(zip.Bytes())); err != nil {
+		return err
+	}
+	if len(boundary) == 0 {
+		return nil
+	}
+	if cells := w.tx.Bucket(boundaryCellsBuck); cells != nil {
+		for _, cell := range CoveringCells(boundary.Bounds()) {
+			if err := cells.Delete(cell.Key(zip)); err != nil {
+				return err
+			}
+		}
+	}
+	return b.Delete(zip.Bytes())
+}
+
+// updateCity adds the zip code to the city or removes it, cities are indexed by their lowercase
+// names while they have zip codes.
+func (w *writer) updateCity(name string, zip Zip, add bool) error {
+	empty := false
+	if err := w.updateZips(citiesBuck, name, func(list ZipList) ZipList {
+		if add {
+			list = list.insert(zip, 0)
+		} else {
+			list = list.remove(zip)
+		}
+		empty = len(list) == 0
+		return list
+	}); err != nil {
+		return err
+	}
+	b, err := w.bucket(cityCasesBuck)
+	if err != nil {
+		return err
+	}
+	if empty {
+		return b.Delete(buckets.CityCaseKey(name))
+	}
+	return b.Put(buckets.CityCaseKey(name), []byte{})
+}
+
+// representCity keeps the city findable by the substrings of its name after the zip code has been
+// added to the cities named so ignoring case or removed from them. Like the importer, a lowercase name
+// is represented by the first zip code of these cities, a zip code is listed once per name it represents.
+func (w *writer) representCity(city string, zip Zip, removed bool) error {
+	rep, ok, err := w.cityRepresentative(city, zip, removed)
+	if err != nil {
+		return err
+	}
+	next, has := zip, true
+	switch {
+	case removed && (!ok || rep != zip):
+		return nil
+	case removed:
+		if next, has, err = w.firstZip(city); err != nil {
+			return err
+		}
+	case ok && string(rep[:]) <= string(zip[:]):
+		return nil
+	}
+	if ok {
+		if err = w.removeSubstrings(subCitiesBuck, city, rep); err != nil {
+			return err
+		}
+	}
+	if !has {
+		return nil
+	}
+	return w.addSubstrings(subCitiesBuck, city, next)
+}
+
+// cityRepresentative finds the zip code representing the lowercase name before the zip code has been
+// added or removed. It's the first zip code named so in the list of the longest substring of the name.
+func (w *writer) cityRepresentative(city string, zip Zip, removed bool) (rep Zip, ok bool, err error) {
+	var probe string
+	w.index.Substrings.Substrings(city, func(substr string) {
+		if len(substr) > len(probe) {
+			probe = substr
+		}
+	})
+	b := w.tx.Bucket(subCitiesBuck)
+	if len(probe) == 0 || b == nil {
+		return
+	}
+	var list ZipList
+	if err = list.Decode(b.Get([]byte(probe))); err != nil {
+		return
+	}
+	for i, z := range list {
+		if i > 0 && list[i-1] == z {
+			continue
+		}
+		if z == zip {
+			if removed {
+				return z, true, nil
+			}
+			continue
+		}
+		info, found, err := w.zipInfo(z)
+		if err != nil {
+			return rep, false, err
+		}
+		if found && containsString(lowerNames(w.cityNames(info)), city) {
+			return z, true, nil
+		}
+	}
+	return
+}
+
+// firstZip returns the first zip code of the cities whose lowercase name is city.
+func (w *writer) firstZip(city string) (first Zip, ok bool, err error) {
+	cases, cities := w.tx.Bucket(cityCasesBuck), w.tx.Bucket(citiesBuck)
+	if cases == nil || cities == nil {
+		return
+	}
+	prefix := append([]byte(city), 0)
+	c := cases.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		var list ZipList
+		if err = list.Decode(cities.Get(k[len(prefix):])); err != nil {
+			return
+		}
+		if len(list) > 0 && (!ok || string(list[0][:]) < string(first[:])) {
+			first, ok = list[0], true
+		}
+	}
+	return
+}
+
+// addSubstrings adds the zip code to the lists of substrings of str.
+func (w *writer) addSubstrings(name []byte, str string, zip Zip) (err error) {
+	w.index.Substrings.Substrings(str, func(substr string) {
+		if err == nil {
+			err = w.updateZips(name, substr, func(list ZipList) ZipList {
+				return list.insert(zip, w.index.Substrings.MaxPostings)
+			})
+		}
+	})
+	return
+}
+
+// removeSubstrings removes the zip code from the lists of substrings of str.
+func (w *writer) removeSubstrings(name []byte, str string, zip Zip) (err error) {
+	w.index.Substrings.Substrings(str, func(substr string) {
+		if err == nil {
+			err = w.updateZips(name, substr, func(list ZipList) ZipList {
+				return list.remove(zip)
+			})
+		}
+	})
+	return
+}
+
+// updateZips updates the zip list of the key, empty lists are deleted.
+func (w *writer) updateZips(name []byte, key string, fn func(list ZipList) ZipList) error {
+	b, err := w.bucket(name)
+	if err != nil {
+		return err
+	}
+	var list ZipList
+	if err = list.Decode(b.Get([]byte(key))); err != nil {
+		return err
+	}
+	if list = fn(list); len(list) == 0 {
+		return b.Delete([]byte(key))
+	}
+	return b.Put([]byte(key), list.Bytes())
+}
+
+// aggregateCities aggregates the details of the cities that have changed, cities without zip codes are deleted.
+func (w *writer) aggregateCities() error {
+	if len(w.cities) == 0 {
+		return nil
+	}
+	infos, err := w.bucket(cityInfoBuck)
+	if err != nil {
+		return err
+	}
+	for _, city := range w.cities {
+		var zips []ZipInfo
+		var list ZipList
+		if b := w.tx.Bucket(citiesBuck); b != nil {
+			if err = list.Decode(b.Get([]byte(city.Name))); err != nil {
+				return err
+			}
+		}
+		for _, zip := range list {
+			info, ok, err := w.zipInfo(zip)
+			if err != nil {
+				return err
+			}
+			// cities list zip codes by aliases and by cities of other states too
+			if ok && info.City == city.Name && strings.EqualFold(info.State, city.State) {
+				zips = append(zips, info)
+			}
+		}
+		if len(zips) == 0 {
+			err = infos.Delete(city.Key())
+		} else {
+			err = infos.Put(city.Key(), NewCityInfo(zips).Bytes())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *writer) putLocation(loc Location) error {
+	locode := loc.Locode
+	b, err := w.bucket(locationsBuck)
+	if err != nil {
+		return err
+	}
+	var prev Location
+	ok := false
+	if v := b.Get(locode.Bytes()); v != nil {
+		if err = prev.Decode(v); err != nil {
+			return err
+		}
+		ok = true
+	}
+	if err = b.Put(locode.Bytes(), loc.Bytes()); err != nil {
+		return err
+	}
+	if ok {
+		if err = w.unindexLocation(prev, loc); err != nil {
+			return err
+		}
+	}
+	return w.indexLocation(loc, prev, ok)
+}
+
+func (w *writer) deleteLocation(locode Locode) error {
+	b := w.tx.Bucket(locationsBuck)
+	if b == nil {
+		return nil
+	}
+	v := b.Get(locode.Bytes())
+	if v == nil {
+		return nil
+	}
+	var prev Location
+	if err := prev.Decode(v); err != nil {
+		return err
+	}
+	if err := b.Delete(locode.Bytes()); err != nil {
+		return err
+	}
+	return w.unindexLocation(prev, Location{})
+}
+
+// unindexLocation removes the previous location from the indexes that the location doesn't share.
+func (w *writer) unindexLocation(prev, loc Location) error {
+	locode := prev.Locode
+	remove := func(list LocodeList) LocodeList {
+		return list.remove(locode)
+	}
+	if prev.Name != loc.Name {
+		// full city name -> locodelist
+		if err := w.updateLocodes(locodesBuck, prev.Name, remove); err != nil {
+			return err
+		}
+	}
+	if city := strings.ToLower(prev.Name); city != strings.ToLower(loc.Name) {
+		// subcities -> locodelist
+		var err error
+		w.index.Substrings.Substrings(city, func(substr string) {
+			if err == nil {
+				err = w.updateLocodes(subLocodesBuck, substr, remove)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if cell, ok := locationCell(prev); ok {
+		if next, ok := locationCell(loc); !ok || next != cell {
+			// grid cell -> locodelist
+			return w.updateLocodes(locodeCellsBuck, string(cell.Bytes()), remove)
+		}
+	}
+	return nil
+}
+
+// indexLocation adds the location to the indexes that the previous location isn't in already.
+func (w *writer) indexLocation(loc, prev Location, ok bool) error {
+	locode := loc.Locode
+	insert := func(max int) func(list LocodeList) LocodeList {
+		return func(list LocodeList) LocodeList {
+			return list.insert(locode, max)
+		}
+	}
+	if !ok || prev.Name != loc.Name {
+		// full city name -> locodelist
+		if err := w.updateLocodes(locodesBuck, loc.Name, insert(0)); err != nil {
+			return err
+		}
+	}
+	if city := strings.ToLower(loc.Name); !ok || city != strings.ToLower(prev.Name) {
+		// subcities -> locodelist
+		var err error
+		w.index.Substrings.Substrings(city, func(substr string) {
+			if err == nil {
+				err = w.updateLocodes(subLocodesBuck, substr, insert(w.index.Substrings.MaxPostings))
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if cell, has := locationCell(loc); has {
+		if prevCell, had := locationCell(prev); !ok || !had || prevCell != cell {
+			// grid cell -> locodelist
+			return w.updateLocodes(locodeCellsBuck, string(cell.Bytes()), insert(0))
+		}
+	}
+	return nil
+}
+
+// locationCell returns the grid cell of the location if it has coordinates.
+func locationCell(loc Location) (Cell, bool) {
+	if !loc.HasCoordinates() {
+		return Cell{}, false
+	}
+	return CellOf(loc.Latitude, loc.Longitude), true
+}
+
+// updateLocodes updates the locode list of the key, empty lists are deleted.
+func (w *writer) updateLocodes(name []byte, key string, fn func(list LocodeList) LocodeList) error {
+	b, err := w.bucket(name)
+	if err != nil {
+		return err
+	}
+	var list LocodeList
+	if err = list.Decode(b.Get([]byte(key))); err != nil {
+		return err
+	}
+	if list = fn(list); len(list) == 0 {
+		return b.Delete([]byte(key))
+	}
+	return b.Put([]byte(key), list.Bytes())
+}
+
+func (w *writer) putBytes(name, key, value []byte) error {
+	b, err := w.bucket(name)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+// touch records the time of the change in the metadata.
+func (w *writer) touch() error {
+	b, err := w.bucket(metaBuck)
+	if err != nil {
+		return err
+	}
+	meta := Metadata{Index: w.index}
+	if v := b.Get(buckets.MetaDataset); v != nil {
+		err = meta.Decode(v)
+	} else {
+		meta.SchemaVersion, err = readSchema(w.tx)
+	}
+	if err != nil {
+		return err
+	}
+	meta.Modified = time.Now().UTC().Truncate(time.Second)
+	return b.Put(buckets.MetaDataset, meta.Bytes())
+}
+
+// insert inserts the zip code into the sorted list, the list is truncated to max entries unless it's zero.
+func (z ZipList) insert(zip Zip, max int) ZipList {
+	i := sort.Search(len(z), func(i int) bool {
+		return string(z[i][:]) > string(zip[:])
+	})
+	z = append(z, Zip{})
+	copy(z[i+1:], z[i:])
+	z[i] = zip
+	if max > 0 && len(z) > max {
+		z = z[:max]
+	}
+	return z
+}
+
+// remove removes an entry of the zip code from the list.
+func (z ZipList) remove(zip Zip) ZipList {
+	for i := range z {
+		if z[i] == zip {
+			return append(z[:i], z[i+1:]...)
+		}
+	}
+	return z
+}
+
+// insert inserts the locode into the sorted list, the list is truncated to max entries unless it's zero.
+func (l LocodeList) insert(locode Locode, max int) LocodeList {
+	i := sort.Search(len(l), func(i int) bool {
+		return string(l[i][:]) > string(locode[:])
+	})
+	l = append(l, Locode{})
+	copy(l[i+1:], l[i:])
+	l[i] = locode
+	if max > 0 && len(l) > max {
+		l = l[:max]
+	}
+	return l
+}
+
+// remove removes the locode from the list.
+func (l LocodeList) remove(locode Locode) LocodeList {
+	for i := range l {
+		if l[i] == locode {
+			return append(l[:i], l[i+1:]...)
+		}
+	}
+	return l
+}
+
+// lowerNames returns the distinct lowercase names.
+func lowerNames(names []string) (lower []string) {
+	for _, name := range names {
+		if name = strings.ToLower(name); !containsString(lower, name) {
+			lower = append(lower, name)
+		}
+	}
+	return
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package ziptools
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writableDB opens a copy of the test database that tests may change.
+func writableDB(t *testing.T) *DB {
+	b, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	path := filepath.Join(t.TempDir(), "zipcodes.db")
+	if err = ioutil.WriteFile(path, b, 0644); err != nil {
+		log.Fatalln(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return db
+}
+
+func TestPutZip(t *testing.T) {
+	db := writableDB(t)
+	defer db.Close()
+	richardson := ZipList{
+		NewZip("75080"), NewZip("75081"), NewZip("75082"), NewZip("75083"), NewZip("75085"),
+	}
+	zip := NewZip("75099")
+	info := ZipInfo{
+		Zip:        zip,
+		Type:       "STANDARD",
+		City:       "Richardson",
+		State:      "TX",
+		County:     "Dallas County",
+		Timezone:   "America/Chicago",
+		Latitude:   32.9512,
+		Longitude:  -96.7234,
+		Population: 1000,
+	}
+	assert.NoError(t, db.PutZip(info))
+
+	got, err := db.GetZipInfo(zip)
+	assert.NoError(t, err)
+	assert.Equal(t, &info, got)
+	zips, err := db.GetZips("Richardson")
+	assert.NoError(t, err)
+	assert.Equal(t, append(richardson, zip), zips)
+	zips, err = db.FindZips("5099")
+	assert.NoError(t, err)
+	assert.Contains(t, zips, zip)
+	at, exact, err := db.ZipAt(32.9512, -96.7234)
+	assert.NoError(t, err)
+	assert.False(t, exact)
+	assert.Equal(t, zip, at)
+	city, err := db.GetCityInfo("Richardson", "TX")
+	assert.NoError(t, err)
+	if assert.NotNil(t, city) {
+		assert.Equal(t, append(richardson, zip), city.Zips)
+		assert.Equal(t, 83338, city.Population)
+	}
+
+	// moving the zip code to a new city updates both cities
+	info.City = "Zipville"
+	assert.NoError(t, db.PutZip(info))
+	zips, err = db.GetZips("Richardson")
+	assert.NoError(t, err)
+	assert.Equal(t, richardson, zips)
+	city, err = db.GetCityInfo("Richardson", "TX")
+	assert.NoError(t, err)
+	if assert.NotNil(t, city) {
+		assert.Equal(t, richardson, city.Zips)
+		assert.Equal(t, 82338, city.Population)
+	}
+	cities, err := db.FindCities("zipvil")
+	assert.NoError(t, err)
+	assert.Equal(t, CityList{"Zipville"}, cities)
+	city, err = db.GetCityInfo("Zipville", "TX")
+	assert.NoError(t, err)
+	if assert.NotNil(t, city) {
+		assert.Equal(t, ZipList{zip}, city.Zips)
+		assert.Equal(t, zip, city.PrimaryZip)
+	}
+
+	meta, err := db.Metadata()
+	assert.NoError(t, err)
+	assert.False(t, meta.Modified.IsZero())
+	assert.Equal(t, errNoZip, db.PutZip(ZipInfo{Zip: zip}))
+}
+
+func TestDeleteZip(t *testing.T) {
+	db := writableDB(t)
+	defer db.Close()
+	zip := NewZip("75083")
+	assert.NoError(t, db.DeleteZip(zip))
+
+	city, err := db.GetCity(zip)
+	assert.NoError(t, err)
+	assert.Empty(t, city)
+	zips, err := db.GetZips("Richardson")
+	assert.NoError(t, err)
+	assert.NotContains(t, zips, zip)
+	zips, err = db.FindZips("5083")
+	assert.NoError(t, err)
+	assert.NotContains(t, zips, zip)
+	info, err := db.GetCityInfo("Richardson", "TX")
+	assert.NoError(t, err)
+	if assert.NotNil(t, info) {
+		assert.NotContains(t, info.Zips, zip)
+	}
+	// deleting a missing zip code does nothing
+	assert.NoError(t, db.DeleteZip(zip))
+
+	// deleting the last zip code of a city deletes the city
+	for _, zip := range info.Zips {
+		assert.NoError(t, db.DeleteZip(zip))
+	}
+	zips, err = db.GetZips("Richardson")
+	assert.NoError(t, err)
+	assert.Empty(t, zips)
+	info, err = db.GetCityInfo("Richardson", "TX")
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+	cities, err := db.FindCities("richardso")
+	assert.NoError(t, err)
+	assert.NotContains(t, cities, "Richardson")
+}
+
+func TestDeleteZipCaseVariant(t *testing.T) {
+	db := writableDB(t)
+	defer db.Close()
+	zip := NewZip("75099")
+	assert.NoError(t, db.PutZip(ZipInfo{Zip: zip, City: "RICHARDSON", State: "TX"}))
+	zips, err := db.GetZips("Richardson")
+	assert.NoError(t, err)
+
+	// the case variant represents the name once the zip codes of the city are gone
+	for _, z := range zips {
+		assert.NoError(t, db.DeleteZip(z))
+	}
+	cities, err := db.FindCities("richardso")
+	assert.NoError(t, err)
+	assert.Contains(t, cities, "RICHARDSON")
+	assert.NotContains(t, cities, "Richardson")
+	assert.NoError(t, db.DeleteZip(zip))
+	cities, err = db.FindCities("richardso")
+	assert.NoError(t, err)
+	assert.NotContains(t, cities, "RICHARDSON")
+}
+
+func TestPutLocation(t *testing.T) {
+	db := writableDB(t)
+	defer db.Close()
+	loc := Location{
+		Name:      "Zipville",
+		State:     "TX",
+		Locode:    NewLocode("ZZZ"),
+		Functions: FunctionRail | FunctionAirport,
+		Latitude:  31.0012,
+		Longitude: -103.0034,
+	}
+	assert.NoError(t, db.PutLocation(loc))
+
+	got, err := db.GetLocation(loc.Locode)
+	assert.NoError(t, err)
+	assert.Equal(t, &loc, got)
+	locodes, err := db.GetLocodes("Zipville")
+	assert.NoError(t, err)
+	assert.Equal(t, LocodeList{loc.Locode}, locodes)
+	locodes, err = db.FindLocodes("zipvil")
+	assert.NoError(t, err)
+	assert.Equal(t, LocodeList{loc.Locode}, locodes)
+	near, err := db.NearestLocations(31.0012, -103.0034, 1, FunctionRail|FunctionAirport)
+	assert.NoError(t, err)
+	if assert.Len(t, near, 1) {
+		assert.Equal(t, loc.Locode, near[0].Locode)
+	}
+
+	// renaming the location moves it to the new city
+	loc.Name = "Zipton"
+	assert.NoError(t, db.PutLocation(loc))
+	locodes, err = db.GetLocodes("Zipville")
+	assert.NoError(t, err)
+	assert.Empty(t, locodes)
+	locodes, err = db.FindLocodes("zipto")
+	assert.NoError(t, err)
+	assert.Equal(t, LocodeList{loc.Locode}, locodes)
+
+	assert.NoError(t, db.DeleteLocation(loc.Locode))
+	locodes, err = db.FindLocodes("zip")
+	assert.NoError(t, err)
+	assert.NotContains(t, locodes, loc.Locode)
+	near, err = db.NearestLocations(31.0012, -103.0034, 1, FunctionRail|FunctionAirport)
+	assert.NoError(t, err)
+	if assert.Len(t, near, 1) {
+		assert.NotEqual(t, loc.Locode, near[0].Locode)
+	}
+	assert.Equal(t, errNoLocode, db.PutLocation(Location{Locode: loc.Locode}))
+}
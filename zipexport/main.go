@@ -0,0 +1,87 @@
+// zipexport tool writes zip code centroids and transport locations as a GeoJSON FeatureCollection.
+//
+// Usage of zipexport:
+//   -bbox="": bounding box to export, as minLat,minLon,maxLat,maxLon
+//   -db="zipcodes.db": specify zip codes database.
+//   -locodes=true: export transport locations
+//   -out="-": file to write GeoJSON to, - for stdout
+//   -states="": comma separated list of states to export
+//   -zips=true: export zip code centroids
+// Export zip codes of New York and New Jersey:
+//   $ zipexport -locodes=false -states NY,NJ -out nynj.geojson
+//
+// Export everything around Dallas:
+//   $ zipexport -bbox 32.5,-97.5,33.2,-96.5 > dallas.geojson
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/xlab/ziptools"
+)
+
+var dbPath string
+var outPath string
+var states string
+var bbox string
+var withZips bool
+var withLocodes bool
+
+func init() {
+	flag.StringVar(&dbPath, "db", "zipcodes.db", "specify zip codes database.")
+	flag.StringVar(&outPath, "out", "-", "file to write GeoJSON to, - for stdout")
+	flag.StringVar(&states, "states", "", "comma separated list of states to export")
+	flag.StringVar(&bbox, "bbox", "", "bounding box to export, as minLat,minLon,maxLat,maxLon")
+	flag.BoolVar(&withZips, "zips", true, "export zip code centroids")
+	flag.BoolVar(&withLocodes, "locodes", true, "export transport locations")
+	flag.Parse()
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func run() error {
+	filter := ziptools.ExportFilter{
+		ExcludeZips:      !withZips,
+		ExcludeLocations: !withLocodes,
+	}
+	if len(states) > 0 {
+		filter.States = strings.Split(states, ",")
+	}
+	if len(bbox) > 0 {
+		box, err := ziptools.ParseBBox(bbox)
+		if err != nil {
+			return err
+		}
+		filter.BBox = box
+	}
+
+	db, err := ziptools.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if outPath != "-" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := db.ExportGeoJSON(w, filter)
+	if err != nil {
+		return err
+	}
+	log.Printf("zipexport: %d features exported", n)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// columnMappings holds column mappings per source file, e.g. {"zips": {"zip": "ZIP Code"}}.
+type columnMappings map[string]map[string]string
+
+// loadColumnMappings reads column mappings from a JSON config file.
+func loadColumnMappings(path string) (columnMappings, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var m columnMappings
+	if err = json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, fmt.Errorf("zipimport: malformed columns config %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// set merges mappings given as a flag, e.g. "zip=ZIP Code,primary_city=4".
+func (c columnMappings) set(source, str string) error {
+	if len(str) == 0 {
+		return nil
+	}
+	if c[source] == nil {
+		c[source] = make(map[string]string)
+	}
+	for _, pair := range strings.Split(str, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			return fmt.Errorf("zipimport: %s: malformed column mapping %q, expected field=column", source, pair)
+		}
+		c[source][strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return nil
+}
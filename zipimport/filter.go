@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/xlab/ziptools"
+	"github.com/xlab/ziptools/importer"
+)
+
+// filterFlags holds the flags that limit the import to a subset.
+type filterFlags struct {
+	states      string
+	zipTypes    string
+	zipPrefixes string
+	countries   string
+	bbox        string
+	functions   string
+}
+
+// filter builds the filter of the import from the flags.
+func (f filterFlags) filter() (filter importer.Filter, err error) {
+	filter.States = splitList(f.states)
+	filter.ZipTypes = splitList(f.zipTypes)
+	filter.ZipPrefixes = splitList(f.zipPrefixes)
+	filter.Countries = splitList(f.countries)
+	filter.Functions = ziptools.ParseFunction(f.functions)
+	if len(f.bbox) > 0 {
+		filter.BBox, err = ziptools.ParseBBox(f.bbox)
+	}
+	return
+}
+
+// splitList splits a comma separated list, empty items are dropped.
+func splitList(str string) (list []string) {
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xlab/ziptools/importer"
+)
+
+// stdinPath stands for the standard input in paths.
+const stdinPath = "-"
+
+// zipMagic are the magic bytes of .zip archives.
+var zipMagic = []byte("PK\x03\x04")
+
+// pathList is a flag with input paths that may be repeated or comma separated.
+// The first value replaces the default paths.
+type pathList struct {
+	paths []string
+	set   bool
+}
+
+func (p *pathList) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(p.paths, ",")
+}
+
+func (p *pathList) Set(str string) error {
+	if !p.set {
+		p.paths, p.set = nil, true
+	}
+	for _, path := range strings.Split(str, ",") {
+		if path = strings.TrimSpace(path); len(path) > 0 {
+			p.paths = append(p.paths, path)
+		}
+	}
+	return nil
+}
+
+// inputs holds the opened input files.
+type inputs struct {
+	closers []io.Closer
+}
+
+// open opens the paths in order. A path may be a plain, gzip or zstd compressed file, or a .zip
+// archive whose data files are separate inputs, see dataFiles. The path "-" stands for the standard input.
+func (in *inputs) open(paths []string) (list []importer.Input, err error) {
+	for _, path := range paths {
+		var opened []importer.Input
+		if opened, err = in.openPath(path); err != nil {
+			return nil, err
+		}
+		list = append(list, opened...)
+	}
+	return
+}
+
+func (in *inputs) openPath(path string) (list []importer.Input, err error) {
+	f := os.Stdin
+	if path != stdinPath {
+		if f, err = os.Open(path); err != nil {
+			return
+		}
+		in.closers = append(in.closers, f)
+	}
+	var size int64
+	if stat, err := f.Stat(); err == nil && stat.Mode().IsRegular() {
+		size = stat.Size()
+	}
+	r := bufio.NewReader(f)
+	if magic, _ := r.Peek(len(zipMagic)); !bytes.Equal(magic, zipMagic) {
+		return []importer.Input{{Name: path, Reader: r, Size: size}}, nil
+	}
+	// archives need random access, the standard input is read into memory
+	var archive *zip.Reader
+	if size > 0 {
+		archive, err = zip.NewReader(f, size)
+	} else {
+		var b []byte
+		if b, err = ioutil.ReadAll(r); err != nil {
+			return
+		}
+		archive, err = zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("zipimport: malformed .zip archive %s: %v", path, err)
+	}
+	for _, file := range dataFiles(path, archive.File) {
+		fr, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("zipimport: %s: %v", path, err)
+		}
+		in.closers = append(in.closers, fr)
+		list = append(list, importer.Input{Name: path + ":" + file.Name, Reader: fr, Size: int64(file.UncompressedSize64)})
+	}
+	return
+}
+
+// dataExts are the extensions of data files in archives.
+var dataExts = map[string]bool{".csv": true, ".txt": true, ".tsv": true, ".json": true, ".geojson": true}
+
+// dataFiles selects the data files of an archive: files with a data extension except readme files
+// and hidden files. Archives of a single dataset with documentation, e.g. GeoNames US.zip with
+// US.txt and readme.txt, are recognized by the file named as the archive, which is the only input then.
+func dataFiles(path string, files []*zip.File) (data []*zip.File) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var named []*zip.File
+	for _, file := range files {
+		base := filepath.Base(file.Name)
+		ext := filepath.Ext(base)
+		if file.FileInfo().IsDir() || !dataExts[strings.ToLower(ext)] ||
+			strings.HasPrefix(base, ".") || strings.HasPrefix(strings.ToLower(base), "readme") ||
+			strings.HasPrefix(file.Name, "__MACOSX/") {
+			continue
+		}
+		data = append(data, file)
+		if strings.EqualFold(strings.TrimSuffix(base, ext), name) {
+			named = append(named, file)
+		}
+	}
+	if len(named) > 0 {
+		return named
+	}
+	return
+}
+
+// close closes the input files.
+func (in *inputs) close() {
+	for _, c := range in.closers {
+		c.Close()
+	}
+}
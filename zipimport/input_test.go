@@ -0,0 +1,62 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeArchive writes a .zip archive with the files.
+func writeArchive(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenArchive(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		archive string
+		files   map[string]string
+		inputs  []string
+	}{
+		{"US.zip", map[string]string{"US.txt": "US\t10001\n", "readme.txt": "GeoNames postal codes\n"}, []string{"US.txt"}},
+		{"zips.zip", map[string]string{"a.csv": "10001\n", "README.md": "zip codes\n"}, []string{"a.csv"}},
+		{"zcta.zip", map[string]string{"zcta.geojson": "{}", "zcta.txt": "notes\n", "docs/": ""}, []string{"zcta.geojson", "zcta.txt"}},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.archive)
+		writeArchive(t, path, test.files)
+		var in inputs
+		list, err := in.open([]string{path})
+		assert.NoError(t, err)
+		var names []string
+		for _, input := range list {
+			names = append(names, input.Name[len(path)+1:])
+			b, err := ioutil.ReadAll(input.Reader)
+			assert.NoError(t, err)
+			assert.Equal(t, test.files[input.Name[len(path)+1:]], string(b))
+		}
+		assert.ElementsMatch(t, test.inputs, names, test.archive)
+		in.close()
+	}
+}
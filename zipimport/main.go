@@ -1,394 +1,226 @@
-// zipimport tool is suited for Bolt DB creation from a gzipped CSV with zip codes.
-// This operation may take a few minutes.
+// zipimport tool is suited for Bolt DB creation from a CSV with zip codes.
+// This operation may take a few minutes, its progress is shown on stderr. The database is built
+// in a temporary file next to the target and renamed over it once complete, so rerunning the import
+// replaces the database. An interrupt aborts the import and leaves the target intact.
+// The tool is a wrapper around the github.com/xlab/ziptools/importer package.
 //
 //   $ zipimport -h
 //   Usage of zipimport:
-//     -zips="zip_code_database.csv.gz": gzipped .csv file with zip codes.
-//     -locodes="us_locode_database.csv.gz": gzipped .csv file with locodes.
+//     -zips=zip_code_database.csv.gz: .csv files with zip codes.
+//     -locodes=us_locode_database.csv.gz: .csv files with locodes.
+//     -zipcolumns="": optional column mapping of zips, e.g. zip=ZIP Code,primary_city=4.
+//     -locodecolumns="": optional column mapping of locodes, e.g. location=3,name=4.
+//     -columns="": optional .json file with column mappings of zips and locodes.
 //     -db="zipcodes.db": file to store a newly created zip codes database.
+//     -postalcodes=: optional .csv files with international postal codes.
+//     -geonames=: optional GeoNames postal code dumps.
+//     -usps=: optional USPS City State Product files.
+//     -aliases=false: index acceptable city aliases of zip codes as cities.
+//     -gazetteer=: optional Census Gazetteer ZCTA files with areas and coordinates.
+//     -hudcounty=: optional HUD USPS ZIP-COUNTY crosswalk .csv files.
+//     -zcta=: optional .geojson files with ZCTA boundaries.
+//     -report="": optional .json file to write the import report to, - for stdout.
+//     -strict=false: abort on the first problem with rows of zips, locodes and postal codes.
+//     -progress=true: show the progress of the import on stderr.
+//     -simplify=0.0001: tolerance in degrees to simplify ZCTA boundaries with.
+//     -geohash=7: precision of zip code geohashes, 1 to 12.
+//     -minsubstr=0: minimum length of indexed substrings of cities and codes.
+//     -maxsubstr=0: maximum length of indexed substrings of cities and codes, 0 for no limit.
+//     -prefixonly=false: index prefixes of cities and codes only.
+//     -maxpostings=0: maximum number of entries per indexed substring, 0 for no limit.
+//     -states="": comma separated list of states to import, e.g. NY,NJ.
+//     -ziptypes="": comma separated list of zip types to import, e.g. STANDARD,PO BOX.
+//     -zipprefixes="": comma separated list of zip prefixes to import, e.g. 100,112.
+//     -countries="": comma separated list of countries to import, e.g. US,CA.
+//     -bbox="": bounding box to import, as minLat,minLon,maxLat,maxLon.
+//     -functions="": UN/LOCODE functions that imported locodes must have, e.g. ---4----.
+//
+// Every flag with files may be repeated or hold comma separated paths, "-" reads the standard input.
+// Files may be plain, gzip or zstd compressed, or .zip archives; the format is detected by magic bytes.
+// Files given for the same flag are merged in order, later files replace the zip codes of earlier ones.
+//
+// Files with zips and locodes may start with a header, columns are found by their names then.
+// Files without a header must follow the layout of the bundled files. A column mapping assigns
+// fields to columns by a header name or a 1-based position, flags override the columns config:
+//
+//   {"zips": {"zip": "ZIP Code", "estimated_population": "15"}, "locodes": {"location": "3"}}
+//
+// The import report counts accepted, skipped, malformed, invalid and duplicate rows of zips, locodes
+// and postal codes per file. Skipped rows are left out by design, e.g. military zips. Problems are
+// listed along with their line numbers: malformed rows are left out, rows with an invalid value are
+// accepted without the value, duplicates replace the rows seen before. The strict mode aborts on
+// the first problem, the report is written anyway.
+//
+// The subset flags build a small database that covers a service area, e.g. zip codes and airports
+// of New York City: -states NY -zipprefixes 100,101,102 -functions ---4----. Every subset flag that
+// is given must match, flags apply to the rows that have the field: zip codes are in the US and have
+// types, locodes have functions. The bounding box leaves out rows without coordinates. Data keyed
+// by zip codes, e.g. boundaries and county shares, is kept for the imported zip codes only.
+//
+// The substring limits shrink the database, the policy is recorded in it. Searches of the database
+// fail for substrings shorter or longer than the limits, with -prefixonly they match prefixes only.
+//
+// Fields of zips: zip, type, primary_city, acceptable_cities, state, county, timezone,
+// latitude, longitude, estimated_population. Fields of locodes: country, location, name,
+// subdivision, function, status, coordinates.
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
-	"encoding/csv"
+	"context"
+	"errors"
 	"flag"
-	"io"
 	"log"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 
-	"github.com/boltdb/bolt"
 	"github.com/xlab/ziptools"
-)
-
-var (
-	citiesBuck     = []byte("cities")
-	zipsBuck       = []byte("zips")
-	locodesBuck    = []byte("locodes")
-	locationsBuck  = []byte("locations")
-	subZipsBuck    = []byte("subzips")
-	subCitiesBuck  = []byte("subcities")
-	subLocodesBuck = []byte("sublocodes")
+	"github.com/xlab/ziptools/importer"
 )
 
 var dbPath string
-var zipsPath string
-var locodesPath string
+var zipsPaths = pathList{paths: []string{"zip_code_database.csv.gz"}}
+var locodesPaths = pathList{paths: []string{"us_locode_database.csv.gz"}}
+var zctaPaths pathList
+var postalCodesPaths pathList
+var geoNamesPaths pathList
+var simplify float64
+var geohashPrecision int
+var indexAliases bool
+var uspsPaths pathList
+var gazetteerPaths pathList
+var hudCountyPaths pathList
+var columnsPath string
+var reportPath string
+var strict bool
+var showProgress bool
+var zipColumns string
+var locodeColumns string
+var substrings ziptools.SubstringPolicy
+var subset filterFlags
+
+// mappings holds the column mappings of CSV files given by flags and the columns config.
+var mappings = make(columnMappings)
 
 func init() {
 	flag.StringVar(&dbPath, "db", "zipcodes.db", "file to store a newly created zip codes database.")
-	flag.StringVar(&zipsPath, "zips", "zip_code_database.csv.gz", "gzipped .csv file with zip codes.")
-	flag.StringVar(&locodesPath, "locodes", "us_locode_database.csv.gz", "gzipped .csv file with locodes.")
-	flag.Parse()
+	flag.Var(&zipsPaths, "zips", ".csv files with zip codes.")
+	flag.Var(&locodesPaths, "locodes", ".csv files with locodes.")
+	flag.StringVar(&zipColumns, "zipcolumns", "", "optional column mapping of zips, e.g. zip=ZIP Code,primary_city=4.")
+	flag.StringVar(&locodeColumns, "locodecolumns", "", "optional column mapping of locodes, e.g. location=3,name=4.")
+	flag.StringVar(&columnsPath, "columns", "", "optional .json file with column mappings of zips and locodes.")
+	flag.Var(&postalCodesPaths, "postalcodes", "optional .csv files with international postal codes.")
+	flag.Var(&geoNamesPaths, "geonames", "optional GeoNames postal code dumps.")
+	flag.Var(&uspsPaths, "usps", "optional USPS City State Product files.")
+	flag.BoolVar(&indexAliases, "aliases", false, "index acceptable city aliases of zip codes as cities.")
+	flag.Var(&gazetteerPaths, "gazetteer", "optional Census Gazetteer ZCTA files with areas and coordinates.")
+	flag.Var(&hudCountyPaths, "hudcounty", "optional HUD USPS ZIP-COUNTY crosswalk .csv files.")
+	flag.Var(&zctaPaths, "zcta", "optional .geojson files with ZCTA boundaries.")
+	flag.StringVar(&reportPath, "report", "", "optional .json file to write the import report to, - for stdout.")
+	flag.BoolVar(&strict, "strict", false, "abort on the first problem with rows of zips, locodes and postal codes.")
+	flag.BoolVar(&showProgress, "progress", true, "show the progress of the import on stderr.")
+	flag.Float64Var(&simplify, "simplify", importer.DefaultSimplify, "tolerance in degrees to simplify ZCTA boundaries with.")
+	flag.IntVar(&geohashPrecision, "geohash", importer.DefaultGeohashPrecision, "precision of zip code geohashes, 1 to 12.")
+	flag.IntVar(&substrings.MinLength, "minsubstr", 0, "minimum length of indexed substrings of cities and codes.")
+	flag.IntVar(&substrings.MaxLength, "maxsubstr", 0, "maximum length of indexed substrings of cities and codes, 0 for no limit.")
+	flag.BoolVar(&substrings.PrefixOnly, "prefixonly", false, "index prefixes of cities and codes only.")
+	flag.IntVar(&substrings.MaxPostings, "maxpostings", 0, "maximum number of entries per indexed substring, 0 for no limit.")
+	flag.StringVar(&subset.states, "states", "", "comma separated list of states to import, e.g. NY,NJ.")
+	flag.StringVar(&subset.zipTypes, "ziptypes", "", "comma separated list of zip types to import, e.g. STANDARD,PO BOX.")
+	flag.StringVar(&subset.zipPrefixes, "zipprefixes", "", "comma separated list of zip prefixes to import, e.g. 100,112.")
+	flag.StringVar(&subset.countries, "countries", "", "comma separated list of countries to import, e.g. US,CA.")
+	flag.StringVar(&subset.bbox, "bbox", "", "bounding box to import, as minLat,minLon,maxLat,maxLon.")
+	flag.StringVar(&subset.functions, "functions", "", "UN/LOCODE functions that imported locodes must have, e.g. ---4----.")
 }
 
 func main() {
+	// flags are parsed here, not in init, so that tests of the package have their own
+	flag.Parse()
 	if err := run(); err != nil {
 		log.Fatalln(err)
 	}
 }
 
-type DB struct {
-	db *bolt.DB
-}
-
 func run() (err error) {
-	db := new(DB)
-
-	// open the DB file
-	if db.db, err = bolt.Open(dbPath, 0644, nil); err != nil {
-		return
-	}
-	defer db.db.Close()
-
-	var r io.Reader
-	var n int
-	gzips, err := os.Open(zipsPath)
-	if err != nil {
-		return
-	}
-	defer gzips.Close()
-	if r, err = gzip.NewReader(gzips); err != nil {
-		return err
-	}
-	if n, err = db.addZips(csv.NewReader(r)); err != nil {
-		return
-	}
-	log.Printf("zipimport: %d zip codes imported", n)
-
-	glocodes, err := os.Open(locodesPath)
-	if err != nil {
-		return
-	}
-	defer glocodes.Close()
-	if r, err = gzip.NewReader(glocodes); err != nil {
-		return err
-	}
-	if n, err = db.addLocations(csv.NewReader(r)); err != nil {
-		return
-	}
-	log.Printf("zipimport: %d locations imported", n)
-
-	if err = db.addLocodes(); err != nil {
-		return
-	}
-	if err = db.addSubstrings(); err != nil {
-		return
-	}
-	log.Println("zipimport: done indexing")
-	return
-}
-
-func (d *DB) addLocations(csv *csv.Reader) (n int, err error) {
-	// begin a writing transaction
-	tx, err := d.db.Begin(true)
-	if err != nil {
-		return
-	}
-	var locations *bolt.Bucket
-	if locations, err = tx.CreateBucketIfNotExists(locationsBuck); err != nil {
-		return
-	}
-	for {
-		var fields []string
-		fields, err = csv.Read()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Println("zipimport: ignored a locode line in CSV due to an error", err)
-			continue
-		}
-		if fields[7] == "RR" || fields[7] == "QQ" || fields[7] == "XX" {
-			continue
-		}
-		location := ziptools.Location{
-			State:  fields[5],
-			Locode: ziptools.NewLocode(fields[2]),
-		}
-		if idx := strings.Index(fields[3], "/"); idx < 0 {
-			location.Name = fields[3]
-		} else {
-			location.Name = fields[3][:idx]
-		}
-		// locode = location
-		if err = locations.Put(location.Locode.Bytes(), location.Bytes()); err != nil {
+	if len(columnsPath) > 0 {
+		if mappings, err = loadColumnMappings(columnsPath); err != nil {
 			return
 		}
-		n++
-	}
-	return n, tx.Commit()
-}
-
-func (d *DB) addZips(csv *csv.Reader) (n int, err error) {
-	// begin a writing transaction
-	tx, err := d.db.Begin(true)
-	if err != nil {
-		return
-	}
-	var zips *bolt.Bucket
-	if zips, err = tx.CreateBucketIfNotExists(zipsBuck); err != nil {
-		return
-	}
-
-	for {
-		var fields []string
-		fields, err = csv.Read()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Println("zipimport: ignored a zip line in CSV due to an error", err)
-			continue
-		}
-		if fields[1] == "MILITARY" {
-			continue
+		if mappings == nil {
+			mappings = make(columnMappings)
 		}
-		zip := ziptools.NewZip(fields[0])
-		// zip = city
-		if err = zips.Put(zip.Bytes(), []byte(fields[2])); err != nil {
-			return
-		}
-		n++
-	}
-	return n, tx.Commit()
-}
-
-func (d *DB) addSubstrings() (err error) {
-	// begin a writing transaction
-	tx, err := d.db.Begin(true)
-	if err != nil {
-		return
-	}
-	// create buckets
-	var cities *bolt.Bucket
-	var subcities *bolt.Bucket
-	var subzips *bolt.Bucket
-
-	if cities, err = tx.CreateBucketIfNotExists(citiesBuck); err != nil {
-		return
 	}
-	if subcities, err = tx.CreateBucketIfNotExists(subCitiesBuck); err != nil {
+	if err = mappings.set("zips", zipColumns); err != nil {
 		return
 	}
-	if subzips, err = tx.CreateBucketIfNotExists(subZipsBuck); err != nil {
+	if err = mappings.set("locodes", locodeColumns); err != nil {
 		return
 	}
-
-	errC := make(chan error, 1)
-	pairs := make(chan struct{ k, v []byte }, 100)
-	go func() {
-		seen := make(map[string]struct{})
-		// this is a writing goroutine
-		for p := range pairs {
-			zip := string(p.k)
-			city := string(bytes.ToLower(p.v))
-			// put full city name -> ziplist
-			list := d.getList(cities, p.v)
-			list = append(list, ziptools.NewZip(zip))
-			if err := cities.Put(p.v, list.Bytes()); err != nil {
-				errC <- err
-				return
-			}
-			// put subzips -> ziplist
-			if err = d.putSubstringZipList(subzips, zip, ziptools.NewZip(zip)); err != nil {
-				errC <- err
-				return
-			}
-			// put subcities -> ziplist
-			// cities are not unique, so filter
-			if _, ok := seen[city]; ok {
-				continue
-			}
-			seen[city] = struct{}{}
-			if err = d.putSubstringZipList(subcities, city, ziptools.NewZip(zip)); err != nil {
-				errC <- err
-				return
-			}
-		}
-		errC <- nil
-	}()
-
-	// Iterate over zip codes in read-only tx
-	if err = d.db.View(func(tx *bolt.Tx) error {
-		if b := tx.Bucket(zipsBuck); b != nil {
-			err := b.ForEach(func(k []byte, v []byte) error {
-				select {
-				case err := <-errC:
-					return err
-				default:
-					pairs <- struct{ k, v []byte }{k, v}
-					return nil
-				}
-			})
-			close(pairs)
-			return err
-		}
-		return bolt.ErrBucketNotFound
-	}); err != nil {
-		return
-	}
-
-	// wait until writer is done
-	if err = <-errC; err != nil {
-		return
-	}
-	return tx.Commit()
-}
-
-func (d *DB) addLocodes() (err error) {
-	// begin a writing transaction
-	tx, err := d.db.Begin(true)
+	filter, err := subset.filter()
 	if err != nil {
 		return
 	}
-	var locodes *bolt.Bucket
-	var sublocodes *bolt.Bucket
-	if locodes, err = tx.CreateBucketIfNotExists(locodesBuck); err != nil {
-		return
-	}
-	if sublocodes, err = tx.CreateBucketIfNotExists(subLocodesBuck); err != nil {
-		return
-	}
-	errC := make(chan error, 1)
-	pairs := make(chan struct{ k, v []byte }, 100)
-	go func() {
-		// this is a writing goroutine
-		for p := range pairs {
-			var location ziptools.Location
-			locode := ziptools.NewLocode(string(p.k))
-			city := location.FromBytes(p.v).Name
-			// put full city name -> locodelist
-			list := d.getListL(locodes, []byte(city))
-			list = append(list, locode)
-			if err := locodes.Put([]byte(city), list.Bytes()); err != nil {
-				errC <- err
-				return
-			}
-			// put subcities -> locodelist
-			str := strings.ToLower(city)
-			if err = d.putSubstringLocodeList(sublocodes, str, locode); err != nil {
-				errC <- err
-				return
-			}
-		}
-		errC <- nil
-	}()
-
-	// Iterate over locations in read-only tx
-	if err = d.db.View(func(tx *bolt.Tx) error {
-		if b := tx.Bucket(locationsBuck); b != nil {
-			err := b.ForEach(func(k []byte, v []byte) error {
-				select {
-				case err := <-errC:
-					return err
-				default:
-					pairs <- struct{ k, v []byte }{k, v}
-					return nil
-				}
-			})
-			close(pairs)
-			return err
-		}
-		return bolt.ErrBucketNotFound
-	}); err != nil {
-		return
-	}
-
-	// wait until writer is done
-	if err = <-errC; err != nil {
-		return
-	}
-	return tx.Commit()
-}
-
-// putSubstringZipList generates all possible substrings (prepend, append),
-// and puts them to bucket as keys to ZipLists.
-func (d *DB) putSubstringZipList(buck *bolt.Bucket, str string, zip ziptools.Zip) error {
-	seen := make(map[string]struct{})
-	put := func(substr string) error {
-		if _, ok := seen[substr]; ok || len(substr) < 1 {
-			return nil
-		}
-		seen[substr] = struct{}{}
-		list := d.getList(buck, []byte(substr))
-		list = append(list, zip)
-		if err := buck.Put([]byte(substr), list.Bytes()); err != nil {
-			return err
+	opts := importer.Options{
+		ZipColumns:       mappings["zips"],
+		LocodeColumns:    mappings["locodes"],
+		IndexAliases:     indexAliases,
+		Filter:           filter,
+		Substrings:       substrings,
+		Simplify:         simplify,
+		GeohashPrecision: geohashPrecision,
+		Strict:           strict,
+		Logf:             log.Printf,
+	}
+	if showProgress {
+		opts.Progress = newProgressLine().show
+	}
+	var in inputs
+	defer in.close()
+	for _, input := range []struct {
+		list  *[]importer.Input
+		paths pathList
+	}{
+		{&opts.Zips, zipsPaths},
+		{&opts.Locodes, locodesPaths},
+		{&opts.PostalCodes, postalCodesPaths},
+		{&opts.GeoNames, geoNamesPaths},
+		{&opts.USPS, uspsPaths},
+		{&opts.Gazetteer, gazetteerPaths},
+		{&opts.HUDCounty, hudCountyPaths},
+		{&opts.ZCTA, zctaPaths},
+	} {
+		if *input.list, err = in.open(input.paths.paths); err != nil {
+			return
 		}
-		return nil
 	}
 
-	for i := range str {
-		if err := put(str[0:i]); err != nil {
-			return err
-		}
+	// an interrupt aborts the import and removes the partial database
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	rpt, err := importer.New(opts).Build(ctx, dbPath)
+	if err == context.Canceled {
+		err = errors.New("zipimport: interrupted, the partial database is removed")
 	}
-	for i := range str {
-		if err := put(str[i:len(str)]); err != nil {
-			return err
+	if len(reportPath) > 0 {
+		if rerr := writeReport(rpt, reportPath); rerr != nil && err == nil {
+			err = rerr
 		}
 	}
-	return nil
+	return
 }
 
-// putSubstringLocodeList generates all possible substrings (prepend, append),
-// and puts them to bucket as keys to LocodeList.
-func (d *DB) putSubstringLocodeList(buck *bolt.Bucket, str string, loc ziptools.Locode) error {
-	seen := make(map[string]struct{})
-	put := func(substr string) error {
-		if _, ok := seen[substr]; ok || len(substr) < 1 {
-			return nil
-		}
-		seen[substr] = struct{}{}
-		list := d.getListL(buck, []byte(substr))
-		list = append(list, loc)
-		if err := buck.Put([]byte(substr), list.Bytes()); err != nil {
-			return err
-		}
-		return nil
+// writeReport writes the report to the path, "-" stands for the standard output.
+func writeReport(rpt *importer.Report, path string) error {
+	if path == stdinPath {
+		return rpt.WriteJSON(os.Stdout)
 	}
-
-	for i := range str {
-		if err := put(str[0:i]); err != nil {
-			return err
-		}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
 	}
-	for i := range str {
-		if err := put(str[i:len(str)]); err != nil {
-			return err
-		}
+	if err = rpt.WriteJSON(f); err != nil {
+		f.Close()
+		return err
 	}
-	return nil
-}
-
-// Gets a ZipList by key from a bucket.
-func (d *DB) getList(buck *bolt.Bucket, key []byte) (list ziptools.ZipList) {
-	return list.FromBytes(buck.Get(key))
-}
-
-// Gets a LocodeList by key from a bucket.
-func (d *DB) getListL(buck *bolt.Bucket, key []byte) (list ziptools.LocodeList) {
-	return list.FromBytes(buck.Get(key))
+	return f.Close()
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/xlab/ziptools/importer"
+)
+
+// progressLine shows the progress of an import on stderr. The line is updated in place on
+// a terminal, otherwise it's logged every few seconds.
+type progressLine struct {
+	terminal bool
+	last     time.Time
+	width    int
+}
+
+func newProgressLine() *progressLine {
+	stat, err := os.Stderr.Stat()
+	return &progressLine{terminal: err == nil && stat.Mode()&os.ModeCharDevice != 0}
+}
+
+func (l *progressLine) show(p importer.Progress) {
+	every := 5 * time.Second
+	if l.terminal {
+		every = time.Second / 4
+	}
+	if !p.Done && time.Since(l.last) < every {
+		return
+	}
+	l.last = time.Now()
+	line := "zipimport: " + p.Phase
+	if len(p.Input) > 0 {
+		line += " " + p.Input
+	} else {
+		line += " " + p.Bucket
+	}
+	switch {
+	case p.Total > 0:
+		line += fmt.Sprintf(": %d of %d rows (%d%%)", p.Rows, p.Total, p.Rows*100/p.Total)
+	default:
+		line += fmt.Sprintf(": %d rows", p.Rows)
+	}
+	if !l.terminal {
+		if !p.Done {
+			log.Println(line)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r%-*s", l.width, line)
+	l.width = len(line)
+	if p.Done {
+		fmt.Fprintln(os.Stderr)
+		l.width = 0
+	}
+}
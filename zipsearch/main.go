@@ -4,6 +4,9 @@
 //   -city=false: given string is a city name or its part
 //   -db="zipcodes.db": specify zip codes database.
 //   -exact=false: look for exact match
+//   -meta=false: print the metadata of the database: sources, build time and counts
+//   -migrate=false: upgrade the database to the current schema version in place
+//   -dryrun=false: report what -migrate would change without changing the database
 // List all zipcodes in city:
 //   $ zipsearch -exact -city Richardson
 //   Zip codes in Richardson: [75080 75081 75082 75083 75085]
@@ -19,12 +22,21 @@
 // List all zips that match the given substring:
 //   $ zipsearch 1337
 //   Zip codes that match 1337: [01337 61337 91337]
+//
+// Tell which data a database has been built from:
+//   $ zipsearch -meta
+//
+// Upgrade a database built by an earlier version of zipimport, see what changes first:
+//   $ zipsearch -migrate -dryrun
+//   $ zipsearch -migrate
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/xlab/ziptools"
@@ -33,16 +45,22 @@ import (
 var dbPath string
 var cityName bool
 var exactMatch bool
+var showMeta bool
+var migrate bool
+var dryRun bool
 
 func init() {
 	flag.BoolVar(&exactMatch, "exact", false, "look for exact match")
 	flag.BoolVar(&cityName, "city", false, "given string is a city name or its part")
 	flag.StringVar(&dbPath, "db", "zipcodes.db", "specify zip codes database.")
+	flag.BoolVar(&showMeta, "meta", false, "print the metadata of the database: sources, build time and counts")
+	flag.BoolVar(&migrate, "migrate", false, "upgrade the database to the current schema version in place")
+	flag.BoolVar(&dryRun, "dryrun", false, "report what -migrate would change without changing the database")
 	flag.Parse()
 }
 
 func main() {
-	if len(flag.Args()) < 1 {
+	if len(flag.Args()) < 1 && !showMeta && !migrate {
 		flag.Usage()
 		return
 	}
@@ -58,6 +76,18 @@ func run() error {
 	}
 	defer db.Close()
 	switch {
+	case migrate:
+		rpt, err := db.Migrate(ziptools.MigrateOptions{DryRun: dryRun})
+		if err != nil {
+			return err
+		}
+		return printJSON(rpt)
+	case showMeta:
+		meta, err := db.Metadata()
+		if err != nil {
+			return err
+		}
+		return printJSON(meta)
 	case exactMatch && cityName:
 		name := strings.Join(flag.Args(), " ")
 		list, err := db.GetZips(name)
@@ -93,3 +123,9 @@ func run() error {
 	}
 	return nil
 }
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}